@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"language-tracker/internal/tasks"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+type QueueTask struct {
+	ID            string          `json:"id"`
+	Queue         string          `json:"queue"`
+	Type          string          `json:"type"`
+	State         string          `json:"state"`
+	Payload       json.RawMessage `json:"payload"`
+	Retried       int             `json:"retried"`
+	MaxRetry      int             `json:"max_retry"`
+	LastErr       string          `json:"last_error"`
+	LastFailedAt  *time.Time      `json:"last_failed_at"`
+	NextProcessAt *time.Time      `json:"next_process_at"`
+}
+
+func newQueueTask(info *asynq.TaskInfo) QueueTask {
+	task := QueueTask{
+		ID:       info.ID,
+		Queue:    info.Queue,
+		Type:     info.Type,
+		State:    info.State.String(),
+		Payload:  json.RawMessage(info.Payload),
+		Retried:  info.Retried,
+		MaxRetry: info.MaxRetry,
+		LastErr:  info.LastErr,
+	}
+
+	if !info.LastFailedAt.IsZero() {
+		task.LastFailedAt = &info.LastFailedAt
+	}
+
+	if !info.NextProcessAt.IsZero() {
+		task.NextProcessAt = &info.NextProcessAt
+	}
+
+	if !json.Valid(info.Payload) {
+		task.Payload = nil
+	}
+
+	if info.Type == tasks.TypeEmailDelivery || info.Type == tasks.TypeRecoveryPasswordDelivery {
+		task.Payload = redactEmailPayload(info.Payload)
+	}
+
+	return task
+}
+
+// redactEmailPayload hides the token and most of the address of an email task,
+// the token of a verification or a password recovery would give away the
+// account.
+func redactEmailPayload(raw []byte) json.RawMessage {
+	var payload tasks.EmailDeliveryPayload
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return nil
+	}
+
+	if payload.Token != "" {
+		payload.Token = "[redacted]"
+	}
+
+	if name, domain, ok := strings.Cut(payload.UserEmail, "@"); ok && name != "" {
+		payload.UserEmail = string([]rune(name)[:1]) + "***@" + domain
+	} else if payload.UserEmail != "" {
+		payload.UserEmail = "[redacted]"
+	}
+
+	redacted, err := json.Marshal(payload)
+	if err != nil {
+		return nil
+	}
+
+	return redacted
+}
+
+func (app *application) listQueues(w http.ResponseWriter, r *http.Request) {
+	queues, err := app.inspector.Queues()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	infos := []*asynq.QueueInfo{}
+	for _, queue := range queues {
+		info, err := app.inspector.GetQueueInfo(queue)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		infos = append(infos, info)
+	}
+
+	err = app.render.JSON(w, 200, infos)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listQueueTasks(w http.ResponseWriter, r *http.Request) {
+	queue := r.PathValue("queue")
+	state := r.URL.Query().Get("state")
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	size, err := strconv.Atoi(r.URL.Query().Get("size"))
+	if err != nil || size < 1 || size > 100 {
+		size = 30
+	}
+
+	opts := []asynq.ListOption{asynq.Page(page), asynq.PageSize(size)}
+
+	var infos []*asynq.TaskInfo
+	switch state {
+	case "pending":
+		infos, err = app.inspector.ListPendingTasks(queue, opts...)
+	case "retry":
+		infos, err = app.inspector.ListRetryTasks(queue, opts...)
+	case "archived", "":
+		infos, err = app.inspector.ListArchivedTasks(queue, opts...)
+	default:
+		app.errorResponse(w, r, 400, "Only pending, retry and archived states are allowed")
+		return
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, asynq.ErrQueueNotFound):
+			app.notFoundResponse(w, r)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	queueTasks := []QueueTask{}
+	for _, info := range infos {
+		queueTasks = append(queueTasks, newQueueTask(info))
+	}
+
+	err = app.render.JSON(w, 200, queueTasks)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) requeueTask(w http.ResponseWriter, r *http.Request) {
+	queue := r.PathValue("queue")
+	id := r.PathValue("id")
+
+	info, err := app.inspector.GetTaskInfo(queue, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, asynq.ErrQueueNotFound), errors.Is(err, asynq.ErrTaskNotFound):
+			app.notFoundResponse(w, r)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.inspector.RunTask(queue, id)
+	if err != nil {
+		app.errorResponse(w, r, http.StatusConflict, err.Error())
+		return
+	}
+
+	if info.Type == tasks.TypeTranscript {
+		var payload tasks.TranscriptPayload
+		if err := json.Unmarshal(info.Payload, &payload); err == nil {
+			err = app.models.Medias.MarkProcessing(payload.UserId, payload.MediaId)
+			if err != nil {
+				app.log.PrintError(err, nil)
+			}
+		}
+	}
+
+	err = app.render.JSON(w, 200, "Task requeued with success")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteQueueTask(w http.ResponseWriter, r *http.Request) {
+	queue := r.PathValue("queue")
+	id := r.PathValue("id")
+
+	err := app.inspector.DeleteTask(queue, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, asynq.ErrQueueNotFound), errors.Is(err, asynq.ErrTaskNotFound):
+			app.notFoundResponse(w, r)
+			return
+		default:
+			app.errorResponse(w, r, http.StatusConflict, err.Error())
+			return
+		}
+	}
+
+	err = app.render.JSON(w, 200, "Task deleted with success")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
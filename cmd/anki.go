@@ -1,7 +1,10 @@
 package main
 
 import (
+	"errors"
+	"language-tracker/internal/data"
 	"net/http"
+	"strconv"
 
 	"github.com/go-playground/validator/v10"
 )
@@ -12,6 +15,7 @@ func (app *application) createAnki(w http.ResponseWriter, r *http.Request) {
 		NewCards       int    `json:"newCards" validate:"required"`
 		Time           int    `json:"time" validate:"required"`
 		TargetLanguage string `json:"target_language" validate:"required"`
+		Date           string `json:"date"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -28,7 +32,13 @@ func (app *application) createAnki(w http.ResponseWriter, r *http.Request) {
 
 	user := app.contextGetUser(r)
 
-	err = app.models.Anki.Insert(user.Id.String(), input.Reviewed, input.NewCards, input.Time, input.TargetLanguage)
+	activityAt, err := parseActivityDate(input.Date, user.Configs.Location())
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Anki.Insert(user.Id.String(), input.Reviewed, input.NewCards, input.Time, input.TargetLanguage, activityAt)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -44,7 +54,7 @@ func (app *application) createAnki(w http.ResponseWriter, r *http.Request) {
 func (app *application) getAnki(w http.ResponseWriter, r *http.Request) {
 	user := app.contextGetUser(r)
 
-	data, err := app.models.Anki.GetByUser(user.Id.String())
+	data, err := app.models.Anki.GetByUser(user)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -56,6 +66,53 @@ func (app *application) getAnki(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (app *application) updateAnki(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Reviewed       *int    `json:"reviewed" validate:"omitempty,min=0"`
+		NewCards       *int    `json:"newCards" validate:"omitempty,min=0"`
+		Time           *int    `json:"time" validate:"omitempty,min=0,max=1439"`
+		TargetLanguage *string `json:"target_language" validate:"omitempty,min=1,max=5"`
+	}
+
+	idAnki, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	err = v.Struct(input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Anki.Update(user, idAnki, input.Reviewed, input.NewCards, input.Time, input.TargetLanguage)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrAnkiNotFound):
+			app.notFoundResponseSpecified(w, r, err)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.render.JSON(w, 200, "Anki updated with success")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
 func (app *application) deleteAnki(w http.ResponseWriter, r *http.Request) {
 	user := app.contextGetUser(r)
 	idAnki := r.PathValue("id")
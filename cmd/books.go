@@ -1,9 +1,22 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"io"
+	"language-tracker/internal/bookmeta"
 	"language-tracker/internal/data"
+	"language-tracker/internal/epub"
+	"language-tracker/internal/ereader"
+	"language-tracker/internal/tasks"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
 )
 
 func (app *application) createBook(w http.ResponseWriter, r *http.Request) {
@@ -12,6 +25,14 @@ func (app *application) createBook(w http.ResponseWriter, r *http.Request) {
 		Pages          string `json:"pages"`
 		Time           int    `json:"time"`
 		TargetLanguage string `json:"target_language"`
+		Date           string `json:"date"`
+		WordsPerPage   *int   `json:"words_per_page" validate:"omitempty,min=1"`
+		WordCount      *int   `json:"word_count" validate:"omitempty,min=1"`
+		ISBN           string `json:"isbn"`
+		Description    string `json:"description"`
+		Format         string `json:"format"`
+		Level          string `json:"level" validate:"max=32"`
+		Duration       int    `json:"duration" validate:"min=0"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -20,9 +41,60 @@ func (app *application) createBook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	validate := validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Format != "" && !data.ValidBookFormat(input.Format) {
+		app.badRequestResponse(w, r, data.ErrInvalidBookFormat)
+		return
+	}
+
 	user := app.contextGetUser(r)
 
-	err = app.models.Book.Insert(user, input.Title, input.Pages, input.TargetLanguage, input.Time)
+	activityAt, err := parseActivityDate(input.Date, user.Configs.Location())
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	info := data.BookInfo{Description: input.Description, Format: input.Format, Level: input.Level}
+
+	// audiobooks track minutes, their duration stands for the pages
+	if input.Format == data.BookFormatAudiobook && input.Duration > 0 {
+		input.Pages = strconv.Itoa(input.Duration)
+	}
+
+	// the fields sent win over the ones found by the ISBN
+	if input.ISBN != "" {
+		metadata, err := app.lookupISBN(r.Context(), input.ISBN)
+		if err != nil {
+			app.bookLookupErrorResponse(w, r, err)
+			return
+		}
+
+		info.ISBN = metadata.ISBN
+		info.Author = truncate(strings.Join(metadata.Authors, ", "), 256)
+		if info.Description == "" {
+			info.Description = metadata.Description
+		}
+		if input.Title == "" {
+			input.Title = truncate(metadata.Title, 256)
+		}
+		if input.Pages == "" && metadata.Pages > 0 {
+			input.Pages = strconv.Itoa(metadata.Pages)
+		}
+		if input.TargetLanguage == "" {
+			input.TargetLanguage = metadata.Language
+		}
+	}
+
+	profile := data.BookProfile{WordsPerPage: input.WordsPerPage, WordCount: input.WordCount}
+
+	err = app.models.Book.Insert(user, input.Title, input.Pages, input.TargetLanguage, input.Time, profile, info, activityAt)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -49,13 +121,49 @@ func (app *application) getBook(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (app *application) updateBookProgress(w http.ResponseWriter, r *http.Request) {
+func (app *application) showBook(w http.ResponseWriter, r *http.Request) {
+	idBook := r.PathValue("idBook")
+
+	user := app.contextGetUser(r)
+
+	book, err := app.models.Book.Get(user, idBook)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrBookNotFound):
+			app.notFoundResponseSpecified(w, r, err)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.render.JSON(w, 200, book)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateBook records the reading progress when read_pages is sent, as it
+// always did, and edits the book details otherwise. A request sending both is
+// rejected rather than dropping one of them.
+func (app *application) updateBook(w http.ResponseWriter, r *http.Request) {
 	idBook := r.PathValue("idBook")
 	var input struct {
-		ReadPages      int    `json:"read_pages"`
-		ReadType       string `json:"read_type"`
-		Time           int    `json:"time"`
-		TargetLanguage string `json:"target_language"`
+		ReadPages *int   `json:"read_pages"`
+		Position  *int   `json:"position"`
+		ReadType  string `json:"read_type"`
+		Time      int    `json:"time"`
+		Date      string `json:"date"`
+
+		Title          *string `json:"title" validate:"omitempty,min=1,max=256"`
+		Description    *string `json:"description"`
+		TargetLanguage *string `json:"target_language" validate:"omitempty,min=1,max=5"`
+		TotalPages     *int    `json:"total_pages" validate:"omitempty,min=1"`
+		WordsPerPage   *int    `json:"words_per_page" validate:"omitempty,min=1"`
+		WordCount      *int    `json:"word_count" validate:"omitempty,min=1"`
+		Format         string  `json:"format"`
+		Level          *string `json:"level" validate:"omitempty,max=32"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -66,7 +174,67 @@ func (app *application) updateBookProgress(w http.ResponseWriter, r *http.Reques
 
 	user := app.contextGetUser(r)
 
-	err = app.models.Book.UpdateBook(user, idBook, input.ReadPages, input.ReadType, input.Time)
+	// the position of an audiobook, in minutes, is its progress
+	if input.ReadPages == nil {
+		input.ReadPages = input.Position
+	}
+
+	details := input.Title != nil || input.Description != nil || input.TargetLanguage != nil || input.TotalPages != nil ||
+		input.WordsPerPage != nil || input.WordCount != nil || input.Format != "" || input.Level != nil
+
+	if input.ReadPages != nil && details {
+		app.badRequestResponse(w, r, errors.New("the progress and the details of a book must be updated in separate requests"))
+		return
+	}
+
+	if input.ReadPages != nil {
+		app.updateBookProgress(w, r, user, idBook, *input.ReadPages, input.ReadType, input.Time, input.Date)
+		return
+	}
+
+	validate := validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Format != "" && !data.ValidBookFormat(input.Format) {
+		app.badRequestResponse(w, r, data.ErrInvalidBookFormat)
+		return
+	}
+
+	profile := data.BookProfile{WordsPerPage: input.WordsPerPage, WordCount: input.WordCount, Format: input.Format}
+
+	err = app.models.Book.Edit(user, idBook, input.Title, input.Description, input.TargetLanguage, input.TotalPages, profile, input.Level)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrBookNotFound):
+			app.notFoundResponseSpecified(w, r, err)
+			return
+		case errors.Is(err, data.ErrTotalPagesTooLow):
+			app.badRequestResponse(w, r, err)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.render.JSON(w, 200, "ok")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateBookProgress(w http.ResponseWriter, r *http.Request, user *data.User, idBook string, readPages int, readType string, minutes int, date string) {
+	activityAt, err := parseActivityDate(date, user.Configs.Location())
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	progress, err := app.models.Book.UpdateBook(user, idBook, readPages, readType, minutes, activityAt)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrPageNumberTooLow):
@@ -76,17 +244,98 @@ func (app *application) updateBookProgress(w http.ResponseWriter, r *http.Reques
 		case errors.Is(err, data.ErrPageNumberTooHigh):
 			app.badRequestResponse(w, r, err)
 			return
+
+		case errors.Is(err, data.ErrPositionTooLow), errors.Is(err, data.ErrPositionTooHigh):
+			app.badRequestResponse(w, r, err)
+			return
 		}
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
+	if progress.Imported {
+		app.enqueueBookWords(user, idBook)
+	}
+
 	err = app.render.JSON(w, 200, "ok")
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+func (app *application) importBook(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 50<<20)
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	defer file.Close()
+
+	book, err := epub.Parse(file, header.Size)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	title := r.FormValue("title")
+	if title == "" {
+		title = book.Title
+	}
+	if title == "" {
+		title = strings.TrimSuffix(header.Filename, filepath.Ext(header.Filename))
+	}
+
+	// the form wins over the language of the EPUB, which is a tag like pt-BR
+	language := r.FormValue("target_language")
+	if language == "" {
+		language = strings.ToLower(strings.SplitN(book.Language, "-", 2)[0])
+	}
+	if language == "" || len(language) > 5 {
+		app.errorResponse(w, r, 400, "The target language is required")
+		return
+	}
+
+	chapters := make([]data.BookChapter, 0, len(book.Chapters))
+	for _, chapter := range book.Chapters {
+		chapters = append(chapters, data.BookChapter{
+			Title:   chapter.Title,
+			Content: chapter.Text,
+			Words:   len(strings.Fields(chapter.Text)),
+		})
+	}
+
+	user := app.contextGetUser(r)
+
+	idBook, err := app.models.Book.Import(user, truncate(title, 256), truncate(book.Author, 256), language, chapters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	detail, err := app.models.Book.Get(user, idBook)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.render.JSON(w, 201, detail)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// truncate cuts a value to the size of its column without splitting a letter.
+func truncate(value string, size int) string {
+	runes := []rune(value)
+	if len(runes) <= size {
+		return value
+	}
+
+	return string(runes[:size])
+}
+
 func (app *application) deleteBook(w http.ResponseWriter, r *http.Request) {
 	idBook := r.PathValue("idBook")
 
@@ -98,6 +347,17 @@ func (app *application) deleteBook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// the words the book added are taken back like those of a deleted media
+	task, err := tasks.NewDeleteBookWordsTask(user.Id.String(), idBook)
+	if err != nil {
+		app.log.PrintError(err, nil)
+	} else {
+		_, err = app.queue.Enqueue(task)
+		if err != nil {
+			app.log.PrintError(err, nil)
+		}
+	}
+
 	err = app.render.JSON(w, 200, "ok")
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -105,18 +365,242 @@ func (app *application) deleteBook(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *application) deleteHistoryBook(w http.ResponseWriter, r *http.Request) {
-	bookHistory := r.PathValue("idBook")
+	bookHistory := r.PathValue("id")
 
 	user := app.contextGetUser(r)
 
-	err := app.models.Book.DeleteHistory(user, bookHistory)
+	idBook, err := app.models.Book.DeleteHistory(user, bookHistory)
 	if err != nil {
+		if errors.Is(err, data.ErrHistoryNotFound) {
+			app.notFoundResponseSpecified(w, r, err)
+			return
+		}
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
+	app.enqueueBookWords(user, idBook)
+
 	err = app.render.JSON(w, 200, "ok")
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+func (app *application) updateHistoryBook(w http.ResponseWriter, r *http.Request) {
+	bookHistory := r.PathValue("id")
+
+	var input struct {
+		ActualPage *int    `json:"actual_page" validate:"omitempty,min=0"`
+		Time       *int    `json:"time" validate:"omitempty,min=0,max=1439"`
+		ReadType   *string `json:"read_type" validate:"omitempty,max=64"`
+		Date       string  `json:"date"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	validate := validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	activityAt, err := parseActivityDate(input.Date, user.Configs.Location())
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	history, err := app.models.Book.EditHistory(user, bookHistory, input.ActualPage, input.Time, input.ReadType, activityAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrHistoryNotFound):
+			app.notFoundResponseSpecified(w, r, err)
+			return
+		case errors.Is(err, data.ErrPageNumberTooLow), errors.Is(err, data.ErrPageNumberTooHigh),
+			errors.Is(err, data.ErrPositionTooLow), errors.Is(err, data.ErrPositionTooHigh):
+			app.badRequestResponse(w, r, err)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	app.enqueueBookWords(user, history.IDBook)
+
+	err = app.render.JSON(w, 200, history)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// enqueueBookWords brings the words of an imported book in line with its
+// history after the history changed. The task does nothing for books without
+// text.
+func (app *application) enqueueBookWords(user *data.User, idBook string) {
+	task, err := tasks.NewBookWordsTask(user.Id.String(), idBook)
+	if err != nil {
+		app.log.PrintError(err, nil)
+		return
+	}
+
+	_, err = app.queue.Enqueue(task)
+	if err != nil {
+		app.log.PrintError(err, nil)
+	}
+}
+
+// importReadings backfills the book history from an e-reader: a Kindle
+// "My Clippings.txt" file or a KOReader statistics.sqlite3 database.
+func (app *application) importReadings(w http.ResponseWriter, r *http.Request) {
+	source := r.PathValue("source")
+	if source != "kindle" && source != "koreader" {
+		app.errorResponse(w, r, 400, "The source must be kindle or koreader")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 100<<20)
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	defer file.Close()
+
+	user := app.contextGetUser(r)
+
+	// the readings are grouped by the days of the user, like the streaks
+	var books []ereader.Book
+	if source == "kindle" {
+		books, err = ereader.ParseClippings(file, user.Configs.Location())
+	} else {
+		books, err = readKOReaderStatistics(file, user.Configs.Location())
+	}
+	if err != nil {
+		if errors.Is(err, ereader.ErrNoReadings) {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		app.badRequestResponse(w, r, errors.New("the file could not be read"))
+		return
+	}
+
+	language := r.FormValue("target_language")
+	if len(language) > 5 {
+		app.errorResponse(w, r, 400, "The target language is invalid")
+		return
+	}
+
+	readings := make([]data.ReadingImport, 0, len(books))
+	for _, book := range books {
+		// KOReader keeps the language of the document, a tag like pt-BR
+		bookLanguage := strings.ToLower(strings.SplitN(book.Language, "-", 2)[0])
+		if len(bookLanguage) > 5 {
+			bookLanguage = ""
+		}
+		if bookLanguage == "" && language == "" {
+			app.errorResponse(w, r, 400, "The target language is required")
+			return
+		}
+
+		days := make([]data.ReadingDay, 0, len(book.Days))
+		for _, day := range book.Days {
+			days = append(days, data.ReadingDay{Date: day.Date, Page: day.Page, Duration: day.Duration})
+		}
+
+		readings = append(readings, data.ReadingImport{
+			Title:      truncate(book.Title, 256),
+			Author:     truncate(book.Author, 256),
+			Language:   bookLanguage,
+			TotalPages: book.TotalPages,
+			Days:       days,
+		})
+	}
+
+	result, err := app.models.Book.ImportReadings(user, source, language, readings)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrPageNumberTooLow), errors.Is(err, data.ErrPageNumberTooHigh),
+			errors.Is(err, data.ErrPositionTooLow), errors.Is(err, data.ErrPositionTooHigh):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	for _, idBook := range result.Books {
+		app.enqueueBookWords(user, idBook)
+	}
+
+	err = app.render.JSON(w, 201, result)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readKOReaderStatistics copies the upload to a temporary file, SQLite only
+// opens databases from disk.
+func readKOReaderStatistics(file io.Reader, loc *time.Location) ([]ereader.Book, error) {
+	tmp, err := os.CreateTemp("", "statistics-*.sqlite3")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	_, err = io.Copy(tmp, file)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return ereader.ReadKOReaderStatistics(tmp.Name(), loc)
+}
+
+func (app *application) lookupBook(w http.ResponseWriter, r *http.Request) {
+	metadata, err := app.lookupISBN(r.Context(), r.URL.Query().Get("isbn"))
+	if err != nil {
+		app.bookLookupErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.render.JSON(w, 200, metadata)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) lookupISBN(ctx context.Context, value string) (*bookmeta.Metadata, error) {
+	isbn, err := bookmeta.NormalizeISBN(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return app.bookMetadata.LookupISBN(ctx, isbn)
+}
+
+func (app *application) bookLookupErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, bookmeta.ErrInvalidISBN):
+		app.badRequestResponse(w, r, err)
+	case errors.Is(err, bookmeta.ErrBookNotFound):
+		app.notFoundResponseSpecified(w, r, err)
+	default:
+		app.logError(r, err)
+		app.errorResponse(w, r, http.StatusBadGateway, "the book metadata service is unavailable")
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"language-tracker/internal/data"
+	"language-tracker/internal/tasks"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const maxFrequencyWords = 50000
+
+// parseFrequencyList reads a ranked word list, the most frequent word first.
+// Plain text lists take the first word of each line, CSV lists take the column
+// named "word" when there is a header and the first column that is not a rank
+// otherwise. A row whose word normalizes to nothing is skipped.
+func parseFrequencyList(r io.Reader, format string) ([]string, error) {
+	var records [][]string
+
+	switch format {
+	case "csv":
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		reader.LazyQuotes = true
+
+		for {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, record)
+		}
+
+	default:
+		content, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if !utf8.Valid(content) {
+			return nil, errors.New("the list must be encoded in UTF-8")
+		}
+
+		for _, line := range strings.Split(string(content), "\n") {
+			records = append(records, strings.Fields(line))
+		}
+	}
+
+	column := -1
+	if len(records) > 0 {
+		for i, field := range records[0] {
+			if strings.EqualFold(strings.TrimSpace(field), "word") {
+				column = i
+				records = records[1:]
+				break
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	words := []string{}
+	for _, record := range records {
+		// the word is the first field that is not a rank, the fields after it
+		// are tags or counts and never stand in for it
+		var word string
+		for i, field := range record {
+			if column >= 0 && i != column {
+				continue
+			}
+			field = strings.TrimSpace(field)
+			if _, err := strconv.Atoi(field); err == nil || field == "" {
+				continue
+			}
+
+			word = tasks.NormalizeWord(field)
+			break
+		}
+
+		if word == "" || seen[word] {
+			continue
+		}
+
+		seen[word] = true
+		words = append(words, word)
+
+		if len(words) == maxFrequencyWords {
+			break
+		}
+	}
+
+	return words, nil
+}
+
+func (app *application) importFrequencyList(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	language := r.URL.Query().Get("language")
+	name := r.URL.Query().Get("name")
+	format := r.URL.Query().Get("format")
+
+	if language == "" {
+		app.errorResponse(w, r, 400, "The language is required")
+		return
+	}
+
+	if utf8.RuneCountInString(language) > 8 {
+		app.errorResponse(w, r, 400, "The language must not be more than 8 characters long")
+		return
+	}
+
+	owner := user
+	if r.URL.Query().Get("shared") == "true" {
+		if !user.IsAdmin {
+			app.notPermittedResponse(w, r)
+			return
+		}
+		owner = nil
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 10<<20)
+
+	body := io.Reader(r.Body)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		defer file.Close()
+
+		body = file
+
+		if name == "" {
+			name = header.Filename
+		}
+
+		if format == "" && strings.EqualFold(filepath.Ext(header.Filename), ".csv") {
+			format = "csv"
+		}
+	}
+
+	if format == "" && strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+		format = "csv"
+	}
+
+	if name == "" {
+		name = language
+	}
+
+	if utf8.RuneCountInString(name) > 128 {
+		app.errorResponse(w, r, 400, "The name must not be more than 128 characters long")
+		return
+	}
+
+	words, err := parseFrequencyList(body, format)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if len(words) == 0 {
+		app.errorResponse(w, r, 400, "The list does not contain any word")
+		return
+	}
+
+	list, err := app.models.Frequency.Import(owner, language, name, words)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.render.JSON(w, 201, list)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getFrequencyLists(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	lists, err := app.models.Frequency.GetByUser(user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.render.JSON(w, 200, lists)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteFrequencyList(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Frequency.Delete(user, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrFrequencyListNotFound):
+			app.notFoundResponseSpecified(w, r, err)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.render.JSON(w, 200, "Frequency list deleted with success")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) userWordsCoverage(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	language := r.URL.Query().Get("language")
+	if language == "" {
+		app.errorResponse(w, r, 400, "The language is required")
+		return
+	}
+
+	coverage, err := app.models.Frequency.Coverage(user, language)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrFrequencyListNotFound):
+			app.notFoundResponseSpecified(w, r, err)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.render.JSON(w, 200, coverage)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
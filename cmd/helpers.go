@@ -6,9 +6,14 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
+var ErrFutureDate = errors.New("the date can not be in the future")
+
 
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
 	maxBytes := 1_048_576
@@ -64,3 +69,57 @@ func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any
 
 	return nil
 }
+
+// readQueryInt returns the integer value of a query string key, or the
+// default value when the key is missing.
+func readQueryInt(qs url.Values, key string, defaultValue int) (int, error) {
+	value := qs.Get(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer value", key)
+	}
+
+	return i, nil
+}
+
+// parseActivityDate reads the optional date of an activity, either as a day
+// (2006-01-02) in the timezone of the user or a full RFC3339 timestamp. An
+// empty value returns nil so the database falls back to the insertion time.
+func parseActivityDate(value string, loc *time.Location) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	now := time.Now()
+
+	date, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		if date.After(now) {
+			return nil, ErrFutureDate
+		}
+		return &date, nil
+	}
+
+	day, err := time.ParseInLocation(time.DateOnly, value, loc)
+	if err != nil {
+		return nil, errors.New("the date must be formatted as YYYY-MM-DD or RFC3339")
+	}
+
+	if day.After(now) {
+		return nil, ErrFutureDate
+	}
+
+	// noon of the day of the user keeps its calendar day whatever the changes
+	// of daylight saving time
+	y, m, d := day.Date()
+	date = time.Date(y, m, d, 12, 0, 0, 0, loc)
+	if date.After(now) {
+		date = now
+	}
+
+	return &date, nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"language-tracker/internal/data"
+	"language-tracker/internal/tasks"
+	"net/http"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+func (app *application) createJournal(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Title          string `json:"title" validate:"max=256"`
+		Text           string `json:"text" validate:"required,max=100000"`
+		Time           int    `json:"time" validate:"min=0,max=1439"`
+		TargetLanguage string `json:"target_language" validate:"omitempty,min=1,max=5"`
+		Date           string `json:"date"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	validate := validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	activityAt, err := parseActivityDate(input.Date, user.Configs.Location())
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.TargetLanguage == "" {
+		input.TargetLanguage = user.Configs.TargetLanguage
+	}
+
+	// the words are counted like the ones of medias, so both sets compare
+	counts, totalWords := tasks.CountWords(input.Text)
+
+	entry, err := app.models.Journal.Insert(user, strings.TrimSpace(input.Title), input.Text, input.TargetLanguage, input.Time, counts, totalWords, activityAt)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.render.JSON(w, 201, entry)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getJournal(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	limit, err := readQueryInt(qs, "limit", 50)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if limit < 1 || limit > 500 {
+		app.errorResponse(w, r, 400, "The limit must be between 1 and 500")
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	entries, err := app.models.Journal.List(user, qs.Get("language"), limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.render.JSON(w, 200, entries)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getJournalNewWords(w http.ResponseWriter, r *http.Request) {
+	idJournal, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	words, err := app.models.Journal.NewWords(user, idJournal.String())
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrJournalNotFound):
+			app.notFoundResponseSpecified(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.render.JSON(w, 200, words)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteJournal(w http.ResponseWriter, r *http.Request) {
+	idJournal, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Journal.Delete(user, idJournal.String())
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrJournalNotFound):
+			app.notFoundResponseSpecified(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.render.JSON(w, 200, "Journal entry deleted with success")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) userActiveVocabulary(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	vocabulary, err := app.models.Journal.ActiveVocabulary(user, r.URL.Query().Get("language"))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.render.JSON(w, 200, vocabulary)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
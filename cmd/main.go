@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"language-tracker/internal/blobstore"
+	"language-tracker/internal/bookmeta"
 	"language-tracker/internal/data"
 	"language-tracker/internal/jsonlog"
 	"language-tracker/internal/tasks"
@@ -9,6 +11,8 @@ import (
 	"net/http"
 	"os"
 	"time"
+	// the timezones of the users are known even without a system tz database
+	_ "time/tzdata"
 
 	"github.com/hibiken/asynq"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -32,11 +36,15 @@ type config struct {
 }
 
 type application struct {
-	render *render.Render
-	log    *jsonlog.Logger
-	models data.Models
-	queue  *asynq.Client
-	config *config
+	render    *render.Render
+	log       *jsonlog.Logger
+	models    data.Models
+	queue     *asynq.Client
+	inspector *asynq.Inspector
+	config    *config
+
+	bookMetadata bookmeta.BookMetadataProvider
+	blobs        blobstore.BlobStore
 }
 
 func init() {
@@ -69,6 +77,14 @@ func main() {
 	})
 	defer client.Close()
 
+	inspector := asynq.NewInspector(asynq.RedisClientOpt{
+		Addr:     os.Getenv("REDIS_HOST") + ":" + os.Getenv("REDIS_PORT"),
+		Password: os.Getenv("REDIS_PASSWORD"),
+		Username: os.Getenv("REDIS_USER"),
+		DB:       0,
+	})
+	defer inspector.Close()
+
 	err = pool.Ping(context.Background())
 	if err != nil {
 		log.Panic(err)
@@ -88,7 +104,8 @@ func main() {
 			Username: os.Getenv("REDIS_USER"),
 		},
 		asynq.Config{
-			Concurrency: 2,
+			Concurrency:  2,
+			ErrorHandler: tasks.HandleTaskError(rdb, pool),
 		},
 	)
 
@@ -97,6 +114,15 @@ func main() {
 	mux.HandleFunc(tasks.TypeTranscript, func(ctx context.Context, t *asynq.Task) error {
 		return tasks.HandleTranscriptTask(ctx, t, rdb, pool)
 	})
+	mux.HandleFunc(tasks.TypeDeleteWords, func(ctx context.Context, t *asynq.Task) error {
+		return tasks.HandleDeleteTranscriptTask(ctx, t, rdb, pool)
+	})
+	mux.HandleFunc(tasks.TypeBookWords, func(ctx context.Context, t *asynq.Task) error {
+		return tasks.HandleBookWordsTask(ctx, t, pool)
+	})
+	mux.HandleFunc(tasks.TypeDeleteBookWords, func(ctx context.Context, t *asynq.Task) error {
+		return tasks.HandleDeleteBookWordsTask(ctx, t, pool)
+	})
 
 	go func() {
 		if err := srv.Run(mux); err != nil {
@@ -105,11 +131,15 @@ func main() {
 	}()
 
 	app := &application{
-		render: render,
-		log:    logger,
-		models: data.NewModel(pool, rdb),
-		queue:  client,
-		config: &configLoaded,
+		render:    render,
+		log:       logger,
+		models:    data.NewModel(pool, rdb),
+		queue:     client,
+		inspector: inspector,
+		config:    &configLoaded,
+
+		bookMetadata: bookmeta.NewCached(bookmeta.NewOpenLibrary(os.Getenv("OPEN_LIBRARY_URL")), rdb, 30*24*time.Hour, logger),
+		blobs:        newBlobStore(),
 	}
 
 	logger.PrintInfo("running on :" + os.Getenv("PORT"), nil)
@@ -128,3 +158,18 @@ func main() {
 		log.Panic(err)
 	}
 }
+
+// newBlobStore keeps the uploads on the local disk unless BLOB_STORE is s3,
+// which also works against a MinIO server.
+func newBlobStore() blobstore.BlobStore {
+	if os.Getenv("BLOB_STORE") == "s3" {
+		return blobstore.NewS3(os.Getenv("S3_ENDPOINT"), os.Getenv("S3_REGION"), os.Getenv("S3_BUCKET"), os.Getenv("S3_ACCESS_KEY"), os.Getenv("S3_SECRET_KEY"))
+	}
+
+	dir := os.Getenv("BLOB_DIR")
+	if dir == "" {
+		dir = "uploads"
+	}
+
+	return blobstore.NewLocal(dir)
+}
@@ -5,8 +5,11 @@ import (
 	"language-tracker/internal/data"
 	"language-tracker/internal/tasks"
 	"net/http"
+	"strings"
 
+	youtubetranscript "github.com/dougbarrett/youtube-transcript"
 	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
 )
 
 func (app *application) createMedia(w http.ResponseWriter, r *http.Request) {
@@ -15,6 +18,7 @@ func (app *application) createMedia(w http.ResponseWriter, r *http.Request) {
 		Kind           string `json:"type"`
 		WatchType      string `json:"watch_type"`
 		TargetLanguage string `json:"target_language" validate:"required"`
+		Date           string `json:"date"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -32,7 +36,13 @@ func (app *application) createMedia(w http.ResponseWriter, r *http.Request) {
 
 	user := app.contextGetUser(r)
 
-	idMedia, videoId, err := app.models.Medias.Insert(user.Id.String(), input.Url, input.Kind, input.WatchType, input.TargetLanguage)
+	activityAt, err := parseActivityDate(input.Date, user.Configs.Location())
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	idMedia, videoId, err := app.models.Medias.Insert(user.Id.String(), input.Url, input.Kind, input.WatchType, input.TargetLanguage, activityAt)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.InvalidUrl):
@@ -60,6 +70,87 @@ func (app *application) createMedia(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (app *application) previewMedia(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Url            string `json:"url"`
+		TargetLanguage string `json:"target_language" validate:"required"`
+	}
+
+	var transcript string
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		r.Body = http.MaxBytesReader(w, r.Body, 5<<20)
+
+		file, _, err := r.FormFile("subtitle")
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		defer file.Close()
+
+		input.TargetLanguage = r.FormValue("target_language")
+
+		transcript, err = tasks.ParseSubtitles(file)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	} else {
+		err := app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		if input.Url == "" {
+			app.errorResponse(w, r, 400, "A youtube url or a subtitle file is required")
+			return
+		}
+	}
+
+	validate := validator.New()
+	err := validate.Struct(input)
+	if err != nil {
+		app.errorResponse(w, r, 400, err)
+		return
+	}
+
+	if input.Url != "" {
+		videoId, err := data.ExtractYouTubeVideoID(input.Url)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		transcript, err = tasks.FetchTranscript(r.Context(), videoId, input.TargetLanguage)
+		if err != nil {
+			switch {
+			case errors.Is(err, youtubetranscript.ErrNoTranscriptFound):
+				app.errorResponse(w, r, http.StatusUnprocessableEntity, "No transcript found for this video in the target language")
+				return
+			default:
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+	}
+
+	words, totalTokens := tasks.CountWords(transcript)
+
+	user := app.contextGetUser(r)
+
+	preview, err := app.models.Medias.Preview(user.Id.String(), input.TargetLanguage, words, totalTokens, 50)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.render.JSON(w, 200, preview)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
 func (app *application) getMedia(w http.ResponseWriter, r *http.Request) {
 	user := app.contextGetUser(r)
 
@@ -76,6 +167,110 @@ func (app *application) getMedia(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (app *application) getMediaWords(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	idMedia, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	onlyNew := r.URL.Query().Get("new") == "true"
+
+	words, err := app.models.Medias.GetWords(user.Id.String(), idMedia.String(), onlyNew)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrMediaNotFound):
+			app.notFoundResponseSpecified(w, r, err)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.render.JSON(w, 200, words)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getMediaStats(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	idMedia, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	stats, err := app.models.Medias.Stats(user.Id.String(), idMedia.String())
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrMediaNotFound):
+			app.notFoundResponseSpecified(w, r, err)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.render.JSON(w, 200, stats)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateMedia(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Title     *string `json:"title" validate:"omitempty,min=1,max=128"`
+		Episode   *string `json:"episode" validate:"omitempty,max=255"`
+		Kind      *string `json:"type" validate:"omitempty,min=1,max=32"`
+		WatchType *string `json:"watch_type" validate:"omitempty,min=1,max=32"`
+		Time      *int    `json:"time" validate:"omitempty,min=0,max=1439"`
+	}
+
+	idMedia, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	validate := validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		app.errorResponse(w, r, 400, err.Error())
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Medias.Update(user, idMedia.String(), input.Title, input.Episode, input.Kind, input.WatchType, input.Time)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrMediaNotFound):
+			app.notFoundResponseSpecified(w, r, err)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.render.JSON(w, 200, "Media updated with success")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
 func (app *application) deleteMedia(w http.ResponseWriter, r *http.Request) {
 	user := app.contextGetUser(r)
 	media := r.PathValue("id")
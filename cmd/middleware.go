@@ -72,6 +72,19 @@ func (app *application) authenticate(next http.HandlerFunc) http.HandlerFunc {
 	})
 }
 
+func (app *application) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return app.authenticate(func(w http.ResponseWriter, r *http.Request) {
+		user := app.contextGetUser(r)
+
+		if !user.IsAdmin {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) recovery(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"language-tracker/internal/data"
+	"language-tracker/internal/tasks"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+)
+
+func (app *application) getDueReviews(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	qs := r.URL.Query()
+
+	limit, err := readQueryInt(qs, "limit", 50)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if limit < 1 || limit > 500 {
+		app.errorResponse(w, r, 400, "The limit must be between 1 and 500")
+		return
+	}
+
+	newPerDay, err := readQueryInt(qs, "new", 10)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if newPerDay < 0 || newPerDay > 100 {
+		app.errorResponse(w, r, 400, "The new cards per day must be between 0 and 100")
+		return
+	}
+
+	queue, err := app.models.Reviews.Due(user, qs.Get("language"), limit, newPerDay)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.render.JSON(w, 200, queue)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) reviewWord(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Language string `json:"language" validate:"required"`
+		Grade    *int   `json:"grade" validate:"required,min=0,max=5"`
+		Seconds  int    `json:"seconds" validate:"min=0,max=3600"`
+	}
+
+	word := tasks.NormalizeWord(r.PathValue("word"))
+	if word == "" {
+		app.badRequestResponse(w, r, ErrInvalidWord)
+		return
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	validate := validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	card, err := app.models.Reviews.Review(user, input.Language, word, *input.Grade, input.Seconds)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrReviewWordNotFound):
+			app.notFoundResponseSpecified(w, r, err)
+			return
+		case errors.Is(err, data.ErrInvalidGrade):
+			app.badRequestResponse(w, r, err)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.render.JSON(w, 200, card)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
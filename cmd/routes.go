@@ -19,6 +19,7 @@ func (app *application) routes() http.Handler {
 		AllowedOrigins: []string{"*"},
 		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
 		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "PATCH", "OPTIONS"},
+		ExposedHeaders: []string{"Link", "X-Total-Count"},
 	}))
 
 	router.HandleFunc("GET /health", app.healthCheck)
@@ -26,34 +27,73 @@ func (app *application) routes() http.Handler {
 	router.HandleFunc("POST /v1/users", app.createUser)
 	router.HandleFunc("GET /v1/user", app.authenticate(app.showUser))
 	router.HandleFunc("GET /v1/user/settings", app.authenticate(app.showUserSettings))
+	router.HandleFunc("GET /v1/user/streaks", app.authenticate(app.userStreaks))
 	router.HandleFunc("PATCH /v1/user/settings", app.authenticate(app.editUserSettings))
 	router.HandleFunc("GET /v1/user/password", app.userRecoveryPassword)
 	router.HandleFunc("GET /v1/users/token/{token}", app.activateAccount)
 	router.HandleFunc("GET /v1/user/words", app.authenticate(app.userWordsKnow))
+	router.HandleFunc("PATCH /v1/user/words", app.authenticate(app.updateUserWords))
+	router.HandleFunc("GET /v1/user/words/coverage", app.authenticate(app.userWordsCoverage))
+	router.HandleFunc("GET /v1/user/words/active", app.authenticate(app.userActiveVocabulary))
+	router.HandleFunc("GET /v1/user/words/export", app.authenticate(app.exportUserWords))
+	router.HandleFunc("GET /v1/user/words/growth", app.authenticate(app.userWordsGrowth))
+	router.HandleFunc("PATCH /v1/user/words/{word}", app.authenticate(app.updateUserWord))
+	router.HandleFunc("GET /v1/user/words/{word}/examples", app.authenticate(app.getUserWordExamples))
 
 	router.HandleFunc("POST /v1/sessions", app.createAuthenticationTokenHandler)
 
+	router.HandleFunc("POST /v1/frequency-lists", app.authenticate(app.importFrequencyList))
+	router.HandleFunc("GET /v1/frequency-lists", app.authenticate(app.getFrequencyLists))
+	router.HandleFunc("DELETE /v1/frequency-lists/{id}", app.authenticate(app.deleteFrequencyList))
+
 	router.HandleFunc("POST /v1/talk", app.authenticate(app.createTalk))
 	router.HandleFunc("GET /v1/talk", app.authenticate(app.getTalk))
+	router.HandleFunc("GET /v1/talk/search", app.authenticate(app.searchTalk))
+	router.HandleFunc("GET /v1/talk/{id}/audio", app.authenticate(app.getTalkAudio))
+	router.HandleFunc("PATCH /v1/talk/{id}", app.authenticate(app.updateTalk))
 	router.HandleFunc("DELETE /v1/talk/{id}", app.authenticate(app.deleteTalk))
 
+	router.HandleFunc("POST /v1/journal", app.authenticate(app.createJournal))
+	router.HandleFunc("GET /v1/journal", app.authenticate(app.getJournal))
+	router.HandleFunc("GET /v1/journal/{id}/words", app.authenticate(app.getJournalNewWords))
+	router.HandleFunc("DELETE /v1/journal/{id}", app.authenticate(app.deleteJournal))
+
 	router.HandleFunc("POST /v1/medias", app.authenticate(app.createMedia))
+	router.HandleFunc("POST /v1/medias/preview", app.authenticate(app.previewMedia))
 	router.HandleFunc("GET /v1/medias", app.authenticate(app.getMedia))
+	router.HandleFunc("GET /v1/medias/{id}/words", app.authenticate(app.getMediaWords))
+	router.HandleFunc("GET /v1/medias/{id}/stats", app.authenticate(app.getMediaStats))
+	router.HandleFunc("PATCH /v1/medias/{id}", app.authenticate(app.updateMedia))
 	router.HandleFunc("DELETE /v1/medias/{id}", app.authenticate(app.deleteMedia))
 
 	router.HandleFunc("POST /v1/anki", app.authenticate(app.createAnki))
 	router.HandleFunc("GET /v1/anki", app.authenticate(app.getAnki))
+	router.HandleFunc("PATCH /v1/anki/{id}", app.authenticate(app.updateAnki))
 	router.HandleFunc("DELETE /v1/anki/{id}", app.authenticate(app.deleteAnki))
 
+	router.HandleFunc("GET /v1/reviews/due", app.authenticate(app.getDueReviews))
+	router.HandleFunc("POST /v1/reviews/{word}", app.authenticate(app.reviewWord))
+
 	router.HandleFunc("POST /v1/vocabulary", app.authenticate(app.createVocabulary))
 	router.HandleFunc("GET /v1/vocabulary", app.authenticate(app.getVocabulary))
+	router.HandleFunc("PATCH /v1/vocabulary/{id}", app.authenticate(app.updateVocabulary))
 	router.HandleFunc("DELETE /v1/vocabulary/{id}", app.authenticate(app.deleteVocabulary))
 
 	router.HandleFunc("POST /v1/books", app.authenticate(app.createBook))
+	router.HandleFunc("POST /v1/books/import", app.authenticate(app.importBook))
+	router.HandleFunc("POST /v1/books/import/{source}", app.authenticate(app.importReadings))
 	router.HandleFunc("GET /v1/books", app.authenticate(app.getBook))
-	router.HandleFunc("PATCH /v1/books/{idBook}", app.authenticate(app.updateBookProgress))
+	router.HandleFunc("GET /v1/books/lookup", app.authenticate(app.lookupBook))
+	router.HandleFunc("GET /v1/books/{idBook}", app.authenticate(app.showBook))
+	router.HandleFunc("PATCH /v1/books/{idBook}", app.authenticate(app.updateBook))
 	router.HandleFunc("DELETE /v1/books/{idBook}", app.authenticate(app.deleteBook))
-	router.HandleFunc("DELETE /v1/books/history/{idBook}", app.authenticate(app.deleteHistoryBook))
+	router.HandleFunc("PATCH /v1/books/history/{id}", app.authenticate(app.updateHistoryBook))
+	router.HandleFunc("DELETE /v1/books/history/{id}", app.authenticate(app.deleteHistoryBook))
+
+	router.HandleFunc("GET /v1/admin/queues", app.requireAdmin(app.listQueues))
+	router.HandleFunc("GET /v1/admin/queues/{queue}/tasks", app.requireAdmin(app.listQueueTasks))
+	router.HandleFunc("POST /v1/admin/queues/{queue}/tasks/{id}/run", app.requireAdmin(app.requeueTask))
+	router.HandleFunc("DELETE /v1/admin/queues/{queue}/tasks/{id}", app.requireAdmin(app.deleteQueueTask))
 	return router
 }
 
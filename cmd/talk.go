@@ -1,21 +1,83 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"io"
+	"language-tracker/internal/audio"
+	"language-tracker/internal/blobstore"
+	"language-tracker/internal/data"
+	"math"
+	"mime/multipart"
 	"net/http"
+	"path"
+	"strconv"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
 )
 
 func (app *application) createTalk(w http.ResponseWriter, r *http.Request) {
 	var input struct {
 		Type string `json:"type" validate:"required"`
-		Time int `json:"time" validate:"required"`
+		Time int `json:"time"`
+		Date string `json:"date"`
+		TargetLanguage string `json:"target_language" validate:"omitempty,min=1,max=5"`
+		Summarize string `json:"summarize" validate:"max=20000"`
+		Partner string `json:"partner" validate:"max=128"`
+		Topic string `json:"topic" validate:"max=256"`
 	}
 
-	err := app.readJSON(w, r, &input)
-	if err != nil {
-		app.badRequestResponse(w, r, err)
-		return
+	var recording multipart.File
+	var info *audio.Info
+	var size int64
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		r.Body = http.MaxBytesReader(w, r.Body, 50<<20)
+
+		file, header, err := r.FormFile("audio")
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		defer file.Close()
+
+		info, err = audio.Probe(file, header.Size)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		recording, size = file, header.Size
+
+		input.Type = r.FormValue("type")
+		input.Date = r.FormValue("date")
+		input.TargetLanguage = r.FormValue("target_language")
+		input.Summarize = r.FormValue("summarize")
+		input.Partner = r.FormValue("partner")
+		input.Topic = r.FormValue("topic")
+
+		if value := r.FormValue("time"); value != "" {
+			input.Time, err = strconv.Atoi(value)
+			if err != nil {
+				app.errorResponse(w, r, 400, "The time must be a number of minutes")
+				return
+			}
+		} else {
+			// the session lasts as long as the recording, rounded up
+			input.Time = max(int(math.Ceil(info.Duration.Minutes())), 1)
+		}
+	} else {
+		err := app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		if input.Time == 0 {
+			app.errorResponse(w, r, 400, "The time is required without an audio recording")
+			return
+		}
 	}
 
 	if input.Time > 4000 || input.Time < 0 {
@@ -24,7 +86,7 @@ func (app *application) createTalk(w http.ResponseWriter, r *http.Request) {
 	}
 
 	validate := validator.New()
-	err = validate.Struct(input)
+	err := validate.Struct(input)
 	if err != nil {
 		errors := err.(validator.ValidationErrors)
 		app.badRequestResponse(w, r, errors)
@@ -33,8 +95,45 @@ func (app *application) createTalk(w http.ResponseWriter, r *http.Request) {
 
 	user := app.contextGetUser(r)
 
-	err = app.models.Talks.Insert(user.Id.String(), input.Type, int16(input.Time), user.Configs.TargetLanguage)
+	activityAt, err := parseActivityDate(input.Date, user.Configs.Location())
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.TargetLanguage == "" {
+		input.TargetLanguage = user.Configs.TargetLanguage
+	}
+
+	notes := data.OutputNotes{Summarize: input.Summarize, Partner: input.Partner, Topic: input.Topic}
+
+	var stored *data.OutputAudio
+	if recording != nil {
+		_, err = recording.Seek(0, io.SeekStart)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		stored = &data.OutputAudio{
+			Key:         "talk/" + user.Id.String() + "/" + uuid.NewString() + "." + info.Format,
+			ContentType: info.ContentType,
+			Size:        size,
+			Seconds:     info.Duration.Seconds(),
+		}
+
+		err = app.blobs.Put(r.Context(), stored.Key, recording, size, info.ContentType)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.models.Talks.Insert(user.Id.String(), input.Type, int16(input.Time), input.TargetLanguage, notes, stored, activityAt)
 	if err != nil {
+		if stored != nil {
+			app.blobs.Delete(context.Background(), stored.Key)
+		}
 		app.serverErrorResponse(w, r, err)
 		return
 	}
@@ -46,10 +145,53 @@ func (app *application) createTalk(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// getTalkAudio streams the recording of a session. http.ServeContent answers
+// range requests, so players can seek without downloading the whole file.
+func (app *application) getTalkAudio(w http.ResponseWriter, r *http.Request) {
+	idTalk, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	recording, err := app.models.Talks.Audio(user, idTalk.String())
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTalkNotFound):
+			app.notFoundResponseSpecified(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if recording == nil {
+		app.errorResponse(w, r, 404, "This talk has no audio recording")
+		return
+	}
+
+	object, err := app.blobs.Open(r.Context(), recording.Key)
+	if err != nil {
+		switch {
+		case errors.Is(err, blobstore.ErrNotFound):
+			app.errorResponse(w, r, 404, "The audio recording could not be found")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	defer object.Close()
+
+	w.Header().Set("Content-Type", recording.ContentType)
+	http.ServeContent(w, r, path.Base(recording.Key), object.ModTime, object)
+}
+
 func (app *application) getTalk(w http.ResponseWriter, r *http.Request) {
 	user := app.contextGetUser(r)
 
-	talks, err := app.models.Talks.GetByUser(user.Id.String())
+	talks, err := app.models.Talks.GetByUser(user)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -62,11 +204,100 @@ func (app *application) getTalk(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (app *application) searchTalk(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	q := strings.TrimSpace(qs.Get("q"))
+	if q == "" {
+		app.errorResponse(w, r, 400, "The search query is required")
+		return
+	}
+
+	limit, err := readQueryInt(qs, "limit", 20)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if limit < 1 || limit > 100 {
+		app.errorResponse(w, r, 400, "The limit must be between 1 and 100")
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	results, err := app.models.Talks.Search(user, q, qs.Get("language"), limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.render.JSON(w, 200, results)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateTalk(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Type           *string `json:"type" validate:"omitempty,min=1,max=128"`
+		Time           *int    `json:"time" validate:"omitempty,min=0,max=1439"`
+		TargetLanguage *string `json:"target_language" validate:"omitempty,min=1,max=5"`
+		Summarize      *string `json:"summarize" validate:"omitempty,max=20000"`
+		Partner        *string `json:"partner" validate:"omitempty,max=128"`
+		Topic          *string `json:"topic" validate:"omitempty,max=256"`
+	}
+
+	idTalk, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	validate := validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		app.errorResponse(w, r, 400, err.Error())
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Talks.Update(user, idTalk.String(), input.Type, input.Time, input.TargetLanguage, input.Summarize, input.Partner, input.Topic)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTalkNotFound):
+			app.notFoundResponseSpecified(w, r, err)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.render.JSON(w, 200, "Talk updated with success")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
 func (app *application) deleteTalk(w http.ResponseWriter, r *http.Request) {
 	user := app.contextGetUser(r)
 	talk := r.PathValue("id")
 
-	err := app.models.Talks.Delete(user, talk)
+	recording, err := app.models.Talks.Audio(user, talk)
+	if err != nil && !errors.Is(err, data.ErrTalkNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Talks.Delete(user, talk)
 	if err != nil {
 		switch {
 		default:
@@ -74,6 +305,13 @@ func (app *application) deleteTalk(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
+
+	if recording != nil {
+		err = app.blobs.Delete(r.Context(), recording.Key)
+		if err != nil {
+			app.logError(r, err)
+		}
+	}
 	err = app.render.JSON(w, 200, "Talk deleted with success")
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
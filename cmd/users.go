@@ -3,6 +3,7 @@ package main
 import (
 	"errors"
 	"language-tracker/internal/data"
+	"language-tracker/internal/streaks"
 	"language-tracker/internal/tasks"
 	"net/http"
 	"strconv"
@@ -20,6 +21,7 @@ type DataUser struct {
 	Anki        *data.AnkiData       `json:"anki"`
 	Books       *data.DataBooks      `json:"books"`
 	Vocabulary  *data.DataVocabulary `json:"vocabulary"`
+	Words       []data.WordsTotal    `json:"words"`
 	MonthReport *[]data.MonthReport  `json:"month_report"`
 	DailyReport *[]data.DailyReport  `json:"daily_report"`
 }
@@ -183,6 +185,10 @@ func (app *application) editUserSettings(w http.ResponseWriter, r *http.Request)
 		AverageWordsPage   int    `json:"awp"`
 		TargetLanguage     string `json:"TL"`
 		DailyGoal          int    `json:"dailyGoal"`
+		LearningThreshold  int    `json:"learningThreshold"`
+		KnownThreshold     int    `json:"knownThreshold"`
+		Timezone           string `json:"timezone"`
+		StreakFreezes      int    `json:"streakFreezes"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -191,11 +197,28 @@ func (app *application) editUserSettings(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if input.Timezone != "" {
+		_, err := time.LoadLocation(input.Timezone)
+		if err != nil {
+			app.errorResponse(w, r, 400, "The timezone must be an IANA name like America/Sao_Paulo")
+			return
+		}
+	}
+
+	if input.StreakFreezes > 31 {
+		app.errorResponse(w, r, 400, "The streak freezes must be at most 31 a month")
+		return
+	}
+
 	newConfig := data.UserConfig{
 		ReadWordsPerMinute:  int32(input.ReadWordsPerMinute),
 		AverageWordsPerPage: int32(input.AverageWordsPage),
 		TargetLanguage:      input.TargetLanguage,
 		DailyGoal:           int32(input.DailyGoal),
+		LearningThreshold:   int32(input.LearningThreshold),
+		KnownThreshold:      int32(input.KnownThreshold),
+		Timezone:            input.Timezone,
+		StreakFreezes:       int32(input.StreakFreezes),
 	}
 
 	err = app.models.Users.Edit(newConfig, user.Id.String())
@@ -207,6 +230,31 @@ func (app *application) editUserSettings(w http.ResponseWriter, r *http.Request)
 	app.render.JSON(w, 200, "User Config changed with success")
 }
 
+func (app *application) userStreaks(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	summary, err := app.models.Users.Streaks(user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	response := struct {
+		Timezone      string `json:"timezone"`
+		StreakFreezes int32  `json:"streakFreezes"`
+		*streaks.Summary
+	}{
+		Timezone:      user.Configs.Location().String(),
+		StreakFreezes: user.Configs.StreakFreezes,
+		Summary:       summary,
+	}
+
+	err = app.render.JSON(w, 200, response)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
 func (app *application) showUser(w http.ResponseWriter, r *http.Request) {
 	user := app.contextGetUser(r)
 
@@ -222,13 +270,13 @@ func (app *application) showUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	output, err := app.models.Talks.GetByUser(user.Id.String())
+	output, err := app.models.Talks.GetByUser(user)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	anki, err := app.models.Anki.GetByUser(user.Id.String())
+	anki, err := app.models.Anki.GetByUser(user)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -246,6 +294,12 @@ func (app *application) showUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	words, err := app.models.Words.Totals(user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	data := DataUser{
 		User:        user,
 		Medias:      &medias,
@@ -253,6 +307,7 @@ func (app *application) showUser(w http.ResponseWriter, r *http.Request) {
 		Anki:        anki,
 		Books:       books,
 		Vocabulary:  vocabulary,
+		Words:       words,
 		MonthReport: monthReport,
 		DailyReport: dailyReport,
 	}
@@ -267,47 +322,66 @@ func (app *application) userExportData(w http.ResponseWriter, r *http.Request) {
 func (app *application) userWordsKnow(w http.ResponseWriter, r *http.Request) {
 	user := app.contextGetUser(r)
 
-	language := r.URL.Query().Get("language")
-	order := strings.ToUpper(r.URL.Query().Get("order"))
-	limitQuery := r.URL.Query().Get("limit")
-	pageQuery := r.URL.Query().Get("page")
-	minQuery := r.URL.Query().Get("min")
-	maxQuery := r.URL.Query().Get("max")
+	qs := r.URL.Query()
 
-	limit, err := strconv.Atoi(limitQuery)
+	filter, err := readWordFilter(qs)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
 
-	page, err := strconv.Atoi(pageQuery)
-	if err != nil {
-		app.badRequestResponse(w, r, err)
-		return
+	filter.Sort = qs.Get("sort")
+	filter.Order = strings.ToLower(qs.Get("order"))
+	filter.Cursor = qs.Get("cursor")
+
+	if filter.Sort == "" {
+		filter.Sort = "amount"
 	}
 
-	min, err := strconv.Atoi(minQuery)
-	if err != nil {
-		app.badRequestResponse(w, r, err)
-		return
+	if filter.Order == "" {
+		filter.Order = "desc"
 	}
 
-	max, err := strconv.Atoi(maxQuery)
+	limit, err := readQueryInt(qs, "limit", 50)
 	if err != nil {
 		app.badRequestResponse(w, r, err)
 		return
 	}
 
-	if order != "ASC" && order != "DESC" {
-		app.errorResponse(w, r, 400, "Only ASC and DESC are allowed")
+	if limit < 1 || limit > 500 {
+		app.errorResponse(w, r, 400, "The limit must be between 1 and 500")
 		return
 	}
+	filter.Limit = limit
 
-	words, err := app.models.Users.GetWords(user, language, order, limit, page, min, max)
+	words, cursor, err := app.models.Words.List(user, filter)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
+		switch {
+		case errors.Is(err, data.ErrInvalidWordSort),
+			errors.Is(err, data.ErrInvalidWordOrder),
+			errors.Is(err, data.ErrInvalidWordStatus),
+			errors.Is(err, data.ErrInvalidWordMatch),
+			errors.Is(err, data.ErrInvalidCursor):
+			app.badRequestResponse(w, r, err)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	// the body stays the array of words it always was, the total and the
+	// next page are sent in headers
+	w.Header().Set("X-Total-Count", strconv.Itoa(words.Total))
+
+	if cursor != "" {
+		next := *r.URL
+		nextQuery := next.Query()
+		nextQuery.Set("cursor", cursor)
+		next.RawQuery = nextQuery.Encode()
+
+		w.Header().Set("Link", "<"+next.RequestURI()+">; rel=\"next\"")
 	}
 
-	app.render.JSON(w, 200, words)
+	app.render.JSON(w, 200, words.Words)
 }
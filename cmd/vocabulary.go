@@ -1,11 +1,19 @@
 package main
 
-import "net/http"
+import (
+	"errors"
+	"language-tracker/internal/data"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
 
 func (app *application) createVocabulary(w http.ResponseWriter, r *http.Request) {
 	var input struct {
 		Vocabulary     int32  `json:"vocabulary"`
 		TargetLanguage string `json:"target_language"`
+		Date           string `json:"date"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -16,7 +24,13 @@ func (app *application) createVocabulary(w http.ResponseWriter, r *http.Request)
 
 	user := app.contextGetUser(r)
 
-	err = app.models.Vocabulary.Insert(user.Id.String(), input.Vocabulary, input.TargetLanguage)
+	activityAt, err := parseActivityDate(input.Date, user.Configs.Location())
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Vocabulary.Insert(user.Id.String(), input.Vocabulary, input.TargetLanguage, activityAt)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -40,6 +54,51 @@ func (app *application) getVocabulary(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (app *application) updateVocabulary(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Vocabulary     *int32  `json:"vocabulary" validate:"omitempty,min=0"`
+		TargetLanguage *string `json:"target_language" validate:"omitempty,min=1,max=255"`
+	}
+
+	idVocabulary, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	validate := validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Vocabulary.Update(user, idVocabulary.String(), input.Vocabulary, input.TargetLanguage)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrVocabularyNotFound):
+			app.notFoundResponseSpecified(w, r, err)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.render.JSON(w, 200, "Vocabulary updated with success")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
 func (app *application) deleteVocabulary(w http.ResponseWriter, r *http.Request) {
 	user := app.contextGetUser(r)
 	vocabulary := r.PathValue("id")
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"language-tracker/internal/apkg"
+	"language-tracker/internal/data"
+	"language-tracker/internal/tasks"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+var ErrInvalidWord = errors.New("the word must have at least three letters")
+
+func (app *application) updateUserWord(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Language string `json:"language" validate:"required"`
+		Status   string `json:"status" validate:"required"`
+	}
+
+	word := tasks.NormalizeWord(r.PathValue("word"))
+	if word == "" {
+		app.badRequestResponse(w, r, ErrInvalidWord)
+		return
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	validate := validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	words, err := app.models.Words.SetStatus(user, input.Language, input.Status, []string{word})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidWordStatus):
+			app.badRequestResponse(w, r, err)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.render.JSON(w, 200, words[0])
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateUserWords(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Language string   `json:"language" validate:"required"`
+		Status   string   `json:"status" validate:"required"`
+		Words    []string `json:"words" validate:"required,min=1,max=1000"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	validate := validator.New()
+	err = validate.Struct(input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	words := make([]string, 0, len(input.Words))
+	for _, rawWord := range input.Words {
+		word := tasks.NormalizeWord(rawWord)
+		if word == "" {
+			app.errorResponse(w, r, 400, ErrInvalidWord.Error()+": "+rawWord)
+			return
+		}
+		words = append(words, word)
+	}
+
+	user := app.contextGetUser(r)
+
+	updated, err := app.models.Words.SetStatus(user, input.Language, input.Status, words)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidWordStatus):
+			app.badRequestResponse(w, r, err)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.render.JSON(w, 200, updated)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getUserWordExamples(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	word := tasks.NormalizeWord(r.PathValue("word"))
+	if word == "" {
+		app.badRequestResponse(w, r, ErrInvalidWord)
+		return
+	}
+
+	examples, err := app.models.Words.Examples(user, word, r.URL.Query().Get("language"))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.render.JSON(w, 200, examples)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) userWordsGrowth(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "week"
+	}
+
+	growth, err := app.models.Words.Growth(user, r.URL.Query().Get("language"), interval)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidInterval):
+			app.badRequestResponse(w, r, err)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.render.JSON(w, 200, growth)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readWordFilter reads the filters shared by the word list and the export.
+func readWordFilter(qs url.Values) (data.WordFilter, error) {
+	filter := data.WordFilter{
+		Language: qs.Get("language"),
+		Status:   qs.Get("status"),
+		Search:   qs.Get("q"),
+		Match:    qs.Get("match"),
+	}
+
+	for _, key := range []string{"min", "max"} {
+		if qs.Get(key) == "" {
+			continue
+		}
+
+		value, err := readQueryInt(qs, key, 0)
+		if err != nil {
+			return filter, err
+		}
+
+		if key == "min" {
+			filter.Min = &value
+		} else {
+			filter.Max = &value
+		}
+	}
+
+	return filter, nil
+}
+
+func (app *application) exportUserWords(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	qs := r.URL.Query()
+
+	format := qs.Get("format")
+	if format == "" {
+		format = "tsv"
+	}
+
+	if format != "tsv" && format != "csv" && format != "apkg" {
+		app.errorResponse(w, r, 400, "Only tsv, csv and apkg formats are allowed")
+		return
+	}
+
+	filter, err := readWordFilter(qs)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	words, err := app.models.Words.Export(user, filter)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidWordStatus),
+			errors.Is(err, data.ErrInvalidWordMatch):
+			app.badRequestResponse(w, r, err)
+			return
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	deckName := "Language Tracker"
+	if filter.Language != "" {
+		deckName += "::" + filter.Language
+	}
+
+	notes := make([]apkg.Note, 0, len(words))
+	for _, word := range words {
+		notes = append(notes, apkg.Note{
+			Fields: []string{word.Word, word.Example, "seen " + strconv.Itoa(word.Amount) + " times"},
+			Tags:   []string{"language-tracker", word.Language, word.Status},
+		})
+	}
+
+	filename := "words"
+	if filter.Language != "" {
+		filename += "-" + filter.Language
+	}
+
+	switch format {
+	case "apkg":
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.apkg"`)
+		err = apkg.Write(w, deckName, notes)
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.csv"`)
+		err = writeWordNotes(w, ',', "Comma", notes)
+	default:
+		w.Header().Set("Content-Type", "text/tab-separated-values; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.tsv"`)
+		err = writeWordNotes(w, '\t', "Tab", notes)
+	}
+
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+// writeWordNotes writes the notes as a text file with the header lines Anki
+// reads to pick the separator, the columns and the tags column on import.
+func writeWordNotes(w io.Writer, separator rune, separatorName string, notes []apkg.Note) error {
+	columns := append(append([]string{}, apkg.Fields...), "Tags")
+
+	header := "#separator:" + separatorName + "\n" +
+		"#html:false\n" +
+		"#columns:" + strings.Join(columns, string(separator)) + "\n" +
+		"#tags column:" + strconv.Itoa(len(columns)) + "\n"
+
+	_, err := io.WriteString(w, header)
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(w)
+	writer.Comma = separator
+
+	for _, note := range notes {
+		record := append(append([]string{}, note.Fields...), strings.Join(note.Tags, " "))
+
+		err := writer.Write(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,281 @@
+// Package apkg writes Anki deck packages, a zip holding the SQLite collection
+// Anki imports, without needing Anki or cgo.
+package apkg
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// modelId is fixed so every export shares the same note type in Anki instead
+// of creating a new one on each import.
+const modelId = 1719000000000
+
+var Fields = []string{"Word", "Example", "Amount"}
+
+// Note is a single card of the deck, its fields follow Fields.
+type Note struct {
+	Fields []string
+	Tags   []string
+}
+
+const schema = `
+CREATE TABLE col (
+	id integer primary key, crt integer not null, mod integer not null, scm integer not null,
+	ver integer not null, dty integer not null, usn integer not null, ls integer not null,
+	conf text not null, models text not null, decks text not null, dconf text not null, tags text not null
+);
+CREATE TABLE notes (
+	id integer primary key, guid text not null, mid integer not null, mod integer not null,
+	usn integer not null, tags text not null, flds text not null, sfld integer not null,
+	csum integer not null, flags integer not null, data text not null
+);
+CREATE TABLE cards (
+	id integer primary key, nid integer not null, did integer not null, ord integer not null,
+	mod integer not null, usn integer not null, type integer not null, queue integer not null,
+	due integer not null, ivl integer not null, factor integer not null, reps integer not null,
+	lapses integer not null, left integer not null, odue integer not null, odid integer not null,
+	flags integer not null, data text not null
+);
+CREATE TABLE revlog (
+	id integer primary key, cid integer not null, usn integer not null, ease integer not null,
+	ivl integer not null, lastIvl integer not null, factor integer not null, time integer not null,
+	type integer not null
+);
+CREATE TABLE graves (usn integer not null, oid integer not null, type integer not null);
+CREATE INDEX ix_notes_usn ON notes (usn);
+CREATE INDEX ix_cards_usn ON cards (usn);
+CREATE INDEX ix_revlog_usn ON revlog (usn);
+CREATE INDEX ix_cards_nid ON cards (nid);
+CREATE INDEX ix_cards_sched ON cards (did, queue, due);
+CREATE INDEX ix_revlog_cid ON revlog (cid);
+CREATE INDEX ix_notes_csum ON notes (csum);`
+
+// Write builds a package with one deck named deckName holding the notes.
+// The ids of the notes and cards are timestamps of the export, but the guid of
+// a note is derived from the deck and its first field, so importing a new
+// export of the same deck updates the cards instead of duplicating them.
+func Write(w io.Writer, deckName string, notes []Note) error {
+	dir, err := os.MkdirTemp("", "apkg")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "collection.anki2")
+
+	err = writeCollection(path, deckName, notes)
+	if err != nil {
+		return err
+	}
+
+	collection, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer collection.Close()
+
+	archive := zip.NewWriter(w)
+
+	file, err := archive.Create("collection.anki2")
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, collection)
+	if err != nil {
+		return err
+	}
+
+	media, err := archive.Create("media")
+	if err != nil {
+		return err
+	}
+
+	_, err = media.Write([]byte("{}"))
+	if err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+func writeCollection(path string, deckName string, notes []Note) error {
+	ctx := context.Background()
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.ExecContext(ctx, schema)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	deckId := 1<<32 + checksum(deckName) // above the default deck and stable across exports
+
+	conf, models, decks, dconf, err := collectionConfig(now, deckId, deckName)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO col VALUES(1, ?, ?, ?, 11, 0, 0, 0, ?, ?, ?, ?, '{}')",
+		now.Truncate(24*time.Hour).Unix(), now.UnixMilli(), now.UnixMilli(), conf, models, decks, dconf)
+	if err != nil {
+		return err
+	}
+
+	insertNote, err := tx.PrepareContext(ctx, "INSERT INTO notes VALUES(?, ?, ?, ?, -1, ?, ?, ?, ?, 0, '')")
+	if err != nil {
+		return err
+	}
+	defer insertNote.Close()
+
+	insertCard, err := tx.PrepareContext(ctx, "INSERT INTO cards VALUES(?, ?, ?, 0, ?, -1, 0, 0, ?, 0, 0, 0, 0, 0, 0, 0, 0, '')")
+	if err != nil {
+		return err
+	}
+	defer insertCard.Close()
+
+	base := now.UnixMilli()
+	for i, note := range notes {
+		id := base + int64(i)
+		sortField := note.Fields[0]
+
+		tags := ""
+		if len(note.Tags) > 0 {
+			tags = " " + strings.Join(note.Tags, " ") + " "
+		}
+
+		_, err = insertNote.ExecContext(ctx, id, guid(deckName, sortField), modelId, now.Unix(), tags,
+			strings.Join(note.Fields, "\x1f"), sortField, checksum(sortField))
+		if err != nil {
+			return err
+		}
+
+		_, err = insertCard.ExecContext(ctx, id, id, deckId, now.Unix(), i+1)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// collectionConfig returns the JSON columns of the col table: the collection
+// configuration, the note type, the decks and the deck options.
+func collectionConfig(now time.Time, deckId int64, deckName string) (conf, models, decks, dconf string, err error) {
+	fields := []map[string]any{}
+	for i, name := range Fields {
+		fields = append(fields, map[string]any{
+			"name": name, "ord": i, "font": "Arial", "size": 20, "rtl": false, "sticky": false, "media": []string{},
+		})
+	}
+
+	model := map[string]any{
+		"id":        modelId,
+		"name":      "Language Tracker Word",
+		"type":      0,
+		"mod":       now.Unix(),
+		"usn":       -1,
+		"sortf":     0,
+		"did":       deckId,
+		"tags":      []string{},
+		"vers":      []int{},
+		"flds":      fields,
+		"req":       []any{[]any{0, "all", []int{0}}},
+		"latexPre":  "\\documentclass[12pt]{article}\n\\special{papersize=3in,5in}\n\\usepackage[utf8]{inputenc}\n\\usepackage{amssymb,amsmath}\n\\pagestyle{empty}\n\\setlength{\\parindent}{0in}\n\\begin{document}\n",
+		"latexPost": "\\end{document}",
+		"css":       ".card { font-family: arial; font-size: 20px; text-align: center; color: black; background-color: white; }",
+		"tmpls": []map[string]any{{
+			"name":  "Card 1",
+			"ord":   0,
+			"qfmt":  "{{Word}}",
+			"afmt":  "{{FrontSide}}<hr id=answer>{{Example}}<br><small>{{Amount}}</small>",
+			"bqfmt": "",
+			"bafmt": "",
+			"did":   nil,
+		}},
+	}
+
+	deck := func(id int64, name string) map[string]any {
+		return map[string]any{
+			"id": id, "name": name, "desc": "", "mod": now.Unix(), "usn": -1, "conf": 1, "dyn": 0, "collapsed": false,
+			"extendNew": 10, "extendRev": 50,
+			"newToday": []int{0, 0}, "revToday": []int{0, 0}, "lrnToday": []int{0, 0}, "timeToday": []int{0, 0},
+		}
+	}
+
+	options := map[string]any{
+		"id": 1, "name": "Default", "mod": 0, "usn": 0, "maxTaken": 60, "autoplay": true, "timer": 0, "replayq": true, "dyn": false,
+		"new": map[string]any{
+			"bury": true, "delays": []int{1, 10}, "initialFactor": 2500, "ints": []int{1, 4, 7}, "order": 1, "perDay": 20, "separate": true,
+		},
+		"rev": map[string]any{
+			"bury": true, "ease4": 1.3, "fuzz": 0.05, "ivlFct": 1, "maxIvl": 36500, "minSpace": 1, "perDay": 100,
+		},
+		"lapse": map[string]any{
+			"delays": []int{10}, "leechAction": 0, "leechFails": 8, "minInt": 1, "mult": 0,
+		},
+	}
+
+	values := []any{
+		map[string]any{
+			"activeDecks": []int64{deckId}, "curDeck": deckId, "newSpread": 0, "collapseTime": 1200, "timeLim": 0,
+			"estTimes": true, "dueCounts": true, "curModel": nil, "nextPos": 1, "sortType": "noteFld",
+			"sortBackwards": false, "addToCur": true,
+		},
+		map[string]any{jsonId(modelId): model},
+		map[string]any{"1": deck(1, "Default"), jsonId(deckId): deck(deckId, deckName)},
+		map[string]any{"1": options},
+	}
+
+	encoded := make([]string, len(values))
+	for i, value := range values {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return "", "", "", "", err
+		}
+		encoded[i] = string(raw)
+	}
+
+	return encoded[0], encoded[1], encoded[2], encoded[3], nil
+}
+
+// checksum is the first 8 hex digits of the sha1 of the text, like Anki does
+// for duplicate detection.
+func checksum(text string) int64 {
+	sum := sha1.Sum([]byte(text))
+	return int64(binary.BigEndian.Uint32(sum[:4]))
+}
+
+func guid(deckName string, sortField string) string {
+	sum := sha1.Sum([]byte(deckName + "\x1f" + sortField))
+	return base64.RawStdEncoding.EncodeToString(sum[:8])
+}
+
+func jsonId(id int64) string {
+	raw, _ := json.Marshal(id)
+	return string(raw)
+}
@@ -0,0 +1,182 @@
+package apkg
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// open writes the deck and opens the collection of the package.
+func open(t *testing.T, deckName string, notes []Note) *sql.DB {
+	t.Helper()
+
+	var b bytes.Buffer
+	err := Write(&b, deckName, notes)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatalf("the package is not a zip: %v", err)
+	}
+
+	files := map[string][]byte{}
+	for _, f := range archive.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name], err = io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if string(files["media"]) != "{}" {
+		t.Errorf("media = %q, want an empty map", files["media"])
+	}
+
+	path := filepath.Join(t.TempDir(), "collection.anki2")
+	err = os.WriteFile(path, files["collection.anki2"], 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func TestWrite(t *testing.T) {
+	notes := []Note{
+		{Fields: []string{"Haus", "Das Haus ist groß.", "12"}, Tags: []string{"de", "learning"}},
+		{Fields: []string{"Baum", "", "3"}},
+	}
+
+	db := open(t, "German::Words", notes)
+	deckId := 1<<32 + checksum("German::Words")
+
+	var ver int
+	var models, decks string
+	err := db.QueryRow("SELECT ver, models, decks FROM col WHERE id = 1").Scan(&ver, &models, &decks)
+	if err != nil {
+		t.Fatalf("reading col: %v", err)
+	}
+
+	if ver != 11 {
+		t.Errorf("col ver = %d, want 11", ver)
+	}
+
+	var modelMap map[string]struct {
+		Name string `json:"name"`
+		Flds []struct {
+			Name string `json:"name"`
+		} `json:"flds"`
+	}
+	if err := json.Unmarshal([]byte(models), &modelMap); err != nil {
+		t.Fatalf("col models: %v", err)
+	}
+	model, ok := modelMap[jsonId(modelId)]
+	if !ok || len(model.Flds) != len(Fields) {
+		t.Errorf("col models = %s, want the note type %d with the fields %v", models, modelId, Fields)
+	}
+
+	var deckMap map[string]struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal([]byte(decks), &deckMap); err != nil {
+		t.Fatalf("col decks: %v", err)
+	}
+	if deckMap[jsonId(deckId)].Name != "German::Words" || deckMap["1"].Name != "Default" {
+		t.Errorf("col decks = %s", decks)
+	}
+
+	rows, err := db.Query("SELECT n.id, n.mid, n.tags, n.flds, n.sfld, n.csum, c.did, c.ord, c.due FROM notes n INNER JOIN cards c ON c.nid = n.id ORDER BY c.due")
+	if err != nil {
+		t.Fatalf("reading notes: %v", err)
+	}
+	defer rows.Close()
+
+	i := 0
+	for rows.Next() {
+		var id, mid, csum, did int64
+		var ord, due int
+		var tags, flds, sfld string
+		if err := rows.Scan(&id, &mid, &tags, &flds, &sfld, &csum, &did, &ord, &due); err != nil {
+			t.Fatal(err)
+		}
+
+		if i >= len(notes) {
+			t.Fatalf("more cards than the %d notes", len(notes))
+		}
+		note := notes[i]
+
+		if mid != modelId || did != deckId || ord != 0 || due != i+1 {
+			t.Errorf("note %d: mid %d, did %d, ord %d, due %d", i, mid, did, ord, due)
+		}
+		if flds != strings.Join(note.Fields, "\x1f") || sfld != note.Fields[0] || csum != checksum(note.Fields[0]) {
+			t.Errorf("note %d: flds %q, sfld %q, csum %d", i, flds, sfld, csum)
+		}
+		if strings.Join(strings.Fields(tags), " ") != strings.Join(note.Tags, " ") {
+			t.Errorf("note %d: tags %q, want %v", i, tags, note.Tags)
+		}
+
+		i++
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if i != len(notes) {
+		t.Errorf("cards = %d, want %d", i, len(notes))
+	}
+}
+
+func TestWriteStableGuid(t *testing.T) {
+	guids := func(notes []Note) map[string]string {
+		db := open(t, "German::Words", notes)
+
+		rows, err := db.Query("SELECT sfld, guid FROM notes")
+		if err != nil {
+			t.Fatalf("reading notes: %v", err)
+		}
+		defer rows.Close()
+
+		found := map[string]string{}
+		for rows.Next() {
+			var sfld, guid string
+			if err := rows.Scan(&sfld, &guid); err != nil {
+				t.Fatal(err)
+			}
+			found[sfld] = guid
+		}
+
+		return found
+	}
+
+	// the second export has new counts and one more word
+	first := guids([]Note{{Fields: []string{"Haus", "", "12"}}, {Fields: []string{"Baum", "", "3"}}})
+	second := guids([]Note{{Fields: []string{"Auto", "", "1"}}, {Fields: []string{"Baum", "", "4"}}, {Fields: []string{"Haus", "", "13"}}})
+
+	for word, guid := range first {
+		if second[word] != guid {
+			t.Errorf("guid of %q = %q then %q, want the same", word, guid, second[word])
+		}
+	}
+
+	if second["Auto"] == second["Haus"] || second["Auto"] == "" {
+		t.Errorf("guids = %v, want one for each word", second)
+	}
+}
@@ -0,0 +1,259 @@
+// Package audio reads the headers of WAV, OGG and MP3 files to learn their
+// format and duration without decoding them.
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("the audio must be a WAV, OGG or MP3 file")
+	ErrInvalidAudio      = errors.New("the audio file is damaged or truncated")
+)
+
+const (
+	FormatWAV = "wav"
+	FormatOGG = "ogg"
+	FormatMP3 = "mp3"
+)
+
+// Info is what the headers of a file tell about it.
+type Info struct {
+	Format      string
+	ContentType string
+	Duration    time.Duration
+}
+
+// Probe detects the format of the audio in r, size bytes long, and computes
+// its duration.
+func Probe(r io.ReaderAt, size int64) (*Info, error) {
+	head := make([]byte, 12)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	head = head[:n]
+
+	var info Info
+	switch {
+	case len(head) == 12 && bytes.Equal(head[0:4], []byte("RIFF")) && bytes.Equal(head[8:12], []byte("WAVE")):
+		info = Info{Format: FormatWAV, ContentType: "audio/wav"}
+		info.Duration, err = wavDuration(r, size)
+	case len(head) >= 4 && bytes.Equal(head[0:4], []byte("OggS")):
+		info = Info{Format: FormatOGG, ContentType: "audio/ogg"}
+		info.Duration, err = oggDuration(r, size)
+	case len(head) >= 3 && (bytes.Equal(head[0:3], []byte("ID3")) || isFrameSync(head)):
+		info = Info{Format: FormatMP3, ContentType: "audio/mpeg"}
+		info.Duration, err = mp3Duration(r, size)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+// wavDuration walks the RIFF chunks: the fmt chunk gives the bytes per second
+// and the data chunk the amount of audio.
+func wavDuration(r io.ReaderAt, size int64) (time.Duration, error) {
+	var byteRate uint32
+	offset := int64(12)
+	header := make([]byte, 8)
+
+	for offset+8 <= size {
+		_, err := r.ReadAt(header, offset)
+		if err != nil {
+			return 0, ErrInvalidAudio
+		}
+
+		id := string(header[0:4])
+		chunkSize := int64(binary.LittleEndian.Uint32(header[4:8]))
+
+		switch id {
+		case "fmt ":
+			format := make([]byte, 12)
+			_, err := r.ReadAt(format, offset+8)
+			if err != nil {
+				return 0, ErrInvalidAudio
+			}
+			byteRate = binary.LittleEndian.Uint32(format[8:12])
+		case "data":
+			if byteRate == 0 {
+				return 0, ErrInvalidAudio
+			}
+			// recorders streaming the file may leave the size unset
+			if chunkSize == 0 || offset+8+chunkSize > size {
+				chunkSize = size - offset - 8
+			}
+			return time.Duration(float64(chunkSize) / float64(byteRate) * float64(time.Second)), nil
+		}
+
+		// chunks are padded to an even size
+		offset += 8 + chunkSize + chunkSize%2
+	}
+
+	return 0, ErrInvalidAudio
+}
+
+// oggTail is how much of the end of an OGG file is read to find its last page.
+const oggTail = 64 << 10
+
+// oggDuration reads the sample rate in the identification header of the first
+// page and the granule position, the samples so far, of the last page.
+func oggDuration(r io.ReaderAt, size int64) (time.Duration, error) {
+	first := make([]byte, 512)
+	n, err := r.ReadAt(first, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+	first = first[:n]
+
+	// the packet starts after the segment table of the page
+	if len(first) < 27 || 27+int(first[26]) > len(first) {
+		return 0, ErrInvalidAudio
+	}
+	packet := first[27+int(first[26]):]
+
+	var rate, preSkip uint64
+	switch {
+	case len(packet) >= 16 && bytes.Equal(packet[0:7], []byte("\x01vorbis")):
+		rate = uint64(binary.LittleEndian.Uint32(packet[12:16]))
+	case len(packet) >= 12 && bytes.Equal(packet[0:8], []byte("OpusHead")):
+		// opus granule positions always count samples at 48 kHz
+		rate = 48000
+		preSkip = uint64(binary.LittleEndian.Uint16(packet[10:12]))
+	case len(packet) >= 31 && bytes.Equal(packet[0:5], []byte("\x7fFLAC")):
+		rate = uint64(binary.BigEndian.Uint32(packet[27:31]) >> 12)
+	default:
+		return 0, ErrUnsupportedFormat
+	}
+
+	if rate == 0 {
+		return 0, ErrInvalidAudio
+	}
+
+	start := max(size-oggTail, 0)
+	tail := make([]byte, size-start)
+	_, err = r.ReadAt(tail, start)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+
+	last := bytes.LastIndex(tail, []byte("OggS"))
+	if last < 0 || last+14 > len(tail) {
+		return 0, ErrInvalidAudio
+	}
+
+	granule := binary.LittleEndian.Uint64(tail[last+6 : last+14])
+	if granule < preSkip {
+		return 0, nil
+	}
+
+	return time.Duration(float64(granule-preSkip) / float64(rate) * float64(time.Second)), nil
+}
+
+var (
+	// mp3Bitrates are the kbps of MPEG-1 and MPEG-2 layer III by index.
+	mp3Bitrates = [2][16]int{
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+	}
+	mp3SampleRates = [3][4]int{
+		{44100, 48000, 32000, 0}, // MPEG-1
+		{22050, 24000, 16000, 0}, // MPEG-2
+		{11025, 12000, 8000, 0},  // MPEG-2.5
+	}
+)
+
+func isFrameSync(b []byte) bool {
+	return len(b) >= 2 && b[0] == 0xFF && b[1]&0xE0 == 0xE0
+}
+
+// mp3Duration skips the ID3v2 tag and reads the first frame. A Xing or Info
+// header gives the frame count of variable bitrate files, otherwise the
+// bitrate of the first frame is taken for the whole file.
+func mp3Duration(r io.ReaderAt, size int64) (time.Duration, error) {
+	offset := int64(0)
+
+	id3 := make([]byte, 10)
+	_, err := r.ReadAt(id3, 0)
+	if err != nil {
+		return 0, ErrInvalidAudio
+	}
+	if bytes.Equal(id3[0:3], []byte("ID3")) {
+		// the tag size is syncsafe, 7 bits per byte
+		tagSize := int64(id3[6])<<21 | int64(id3[7])<<14 | int64(id3[8])<<7 | int64(id3[9])
+		offset = 10 + tagSize
+		if id3[5]&0x10 != 0 {
+			offset += 10
+		}
+	}
+
+	// a frame is searched in the first kilobytes after the tag
+	window := make([]byte, 16<<10)
+	n, err := r.ReadAt(window, offset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+	window = window[:n]
+
+	for i := 0; i+4 <= len(window); i++ {
+		if !isFrameSync(window[i:]) {
+			continue
+		}
+
+		header := window[i : i+4]
+		version := (header[1] >> 3) & 0x03 // 3 MPEG-1, 2 MPEG-2, 0 MPEG-2.5
+		layer := (header[1] >> 1) & 0x03   // 1 layer III
+		bitrateIndex := header[2] >> 4
+		rateIndex := (header[2] >> 2) & 0x03
+
+		if version == 1 || layer != 1 || bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 {
+			continue
+		}
+
+		table, rates, samplesPerFrame := 0, 0, 1152
+		switch version {
+		case 2:
+			table, rates, samplesPerFrame = 1, 1, 576
+		case 0:
+			table, rates, samplesPerFrame = 1, 2, 576
+		}
+
+		bitrate := mp3Bitrates[table][bitrateIndex] * 1000
+		sampleRate := mp3SampleRates[rates][rateIndex]
+
+		// the Xing header sits after the side information of the first frame
+		mono := header[3]>>6 == 3
+		sideInfo := 32
+		switch {
+		case version == 3 && mono:
+			sideInfo = 17
+		case version != 3 && mono:
+			sideInfo = 9
+		case version != 3:
+			sideInfo = 17
+		}
+
+		xing := i + 4 + sideInfo
+		if xing+12 <= len(window) {
+			tag := string(window[xing : xing+4])
+			flags := binary.BigEndian.Uint32(window[xing+4 : xing+8])
+			if (tag == "Xing" || tag == "Info") && flags&0x01 != 0 {
+				frames := binary.BigEndian.Uint32(window[xing+8 : xing+12])
+				return time.Duration(float64(frames) * float64(samplesPerFrame) / float64(sampleRate) * float64(time.Second)), nil
+			}
+		}
+
+		audioBytes := size - offset - int64(i)
+		return time.Duration(float64(audioBytes) * 8 / float64(bitrate) * float64(time.Second)), nil
+	}
+
+	return 0, ErrInvalidAudio
+}
@@ -0,0 +1,157 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+)
+
+func wavFile(seconds int) []byte {
+	const rate = 8000
+
+	var b bytes.Buffer
+	data := make([]byte, rate*2*seconds)
+	b.WriteString("RIFF")
+	binary.Write(&b, binary.LittleEndian, uint32(36+len(data)))
+	b.WriteString("WAVEfmt ")
+	binary.Write(&b, binary.LittleEndian, struct {
+		Size                       uint32
+		Format, Channels           uint16
+		SampleRate, ByteRate       uint32
+		BlockAlign, BitsPerSamples uint16
+	}{16, 1, 1, rate, rate * 2, 2, 16})
+	b.WriteString("data")
+	binary.Write(&b, binary.LittleEndian, uint32(len(data)))
+	b.Write(data)
+
+	return b.Bytes()
+}
+
+func oggPage(granule uint64, packet []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("OggS")
+	b.Write([]byte{0, 0})
+	binary.Write(&b, binary.LittleEndian, granule)
+	b.Write(make([]byte, 12)) // serial, sequence and checksum
+	b.WriteByte(1)
+	b.WriteByte(byte(len(packet)))
+	b.Write(packet)
+
+	return b.Bytes()
+}
+
+func oggFile(seconds int) []byte {
+	const rate = 44100
+
+	header := []byte("\x01vorbis")
+	header = append(header, 0, 0, 0, 0, 2)
+	header = binary.LittleEndian.AppendUint32(header, rate)
+	header = append(header, make([]byte, 14)...)
+
+	file := oggPage(0, header)
+	file = append(file, oggPage(0, make([]byte, 100))...)
+	file = append(file, oggPage(uint64(rate*seconds), make([]byte, 100))...)
+
+	return file
+}
+
+func mp3File(seconds int) []byte {
+	// MPEG-1 layer III, 128 kbps, 44.1 kHz, stereo: 417 bytes a frame
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xFF, 0xFB, 0x90, 0x00})
+
+	frames := seconds * 44100 / 1152
+	file := make([]byte, 0, frames*len(frame))
+	for range frames {
+		file = append(file, frame...)
+	}
+
+	return file
+}
+
+func TestProbe(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     []byte
+		format   string
+		duration time.Duration
+	}{
+		{"wav", wavFile(90), FormatWAV, 90 * time.Second},
+		{"ogg", oggFile(75), FormatOGG, 75 * time.Second},
+		{"mp3", mp3File(60), FormatMP3, 60 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := Probe(bytes.NewReader(tt.file), int64(len(tt.file)))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if info.Format != tt.format {
+				t.Errorf("format = %q, want %q", info.Format, tt.format)
+			}
+
+			if diff := info.Duration - tt.duration; diff < -time.Second || diff > time.Second {
+				t.Errorf("duration = %v, want %v", info.Duration, tt.duration)
+			}
+		})
+	}
+}
+
+func TestProbeTruncated(t *testing.T) {
+	files := map[string][]byte{
+		"wav": wavFile(1),
+		"ogg": oggFile(1),
+		"mp3": mp3File(1),
+	}
+
+	// every prefix of a valid file must fail cleanly or succeed, never panic
+	for name, file := range files {
+		for size := 0; size < min(len(file), 1024); size++ {
+			_, _ = Probe(bytes.NewReader(file[:size]), int64(size))
+		}
+		t.Logf("%s: probed %d prefixes", name, min(len(file), 1024))
+	}
+}
+
+func TestProbeMalformed(t *testing.T) {
+	segments := append([]byte("OggS"), make([]byte, 36)...)
+	segments[26] = 200
+
+	noFormat := wavFile(1)
+	copy(noFormat[12:16], "junk")
+
+	noData := wavFile(1)[:44]
+	copy(noData[36:40], "junk")
+
+	badFrame := append([]byte("ID3\x03\x00\x00\x00\x00\x00\x00"), bytes.Repeat([]byte{0xFF, 0xE0, 0xF0, 0x00}, 16)...)
+
+	tests := []struct {
+		name string
+		file []byte
+		want error
+	}{
+		{"empty", nil, ErrUnsupportedFormat},
+		{"text", []byte("hello, this is not audio"), ErrUnsupportedFormat},
+		{"ogg segment table past the end", segments, ErrInvalidAudio},
+		{"ogg short page", []byte("OggS\x00\x02"), ErrInvalidAudio},
+		{"ogg unknown codec", oggPage(0, []byte("\x01unknown-codec-header")), ErrUnsupportedFormat},
+		{"wav without fmt chunk", noFormat, ErrInvalidAudio},
+		{"wav without data chunk", noData, ErrInvalidAudio},
+		{"wav only header", []byte("RIFF\x00\x00\x00\x00WAVE"), ErrInvalidAudio},
+		{"mp3 tag without frames", []byte("ID3\x03\x00\x00\x00\x00\x00\x00"), ErrInvalidAudio},
+		{"mp3 invalid frame headers", badFrame, ErrInvalidAudio},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Probe(bytes.NewReader(tt.file), int64(len(tt.file)))
+			if !errors.Is(err, tt.want) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
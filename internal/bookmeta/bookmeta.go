@@ -0,0 +1,293 @@
+// Package bookmeta looks up the metadata of books by ISBN.
+package bookmeta
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"language-tracker/internal/jsonlog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrInvalidISBN  = errors.New("the ISBN is not a valid ISBN-10 or ISBN-13")
+	ErrBookNotFound = errors.New("no book was found with this ISBN")
+)
+
+// Metadata is what a provider knows about a book. Language is a two letter
+// code like the target languages of the tracker, empty when unknown.
+type Metadata struct {
+	ISBN        string   `json:"isbn"`
+	Title       string   `json:"title"`
+	Authors     []string `json:"authors"`
+	Description string   `json:"description"`
+	Pages       int      `json:"pages"`
+	Language    string   `json:"language"`
+}
+
+// BookMetadataProvider finds the metadata of a book by its normalized ISBN.
+type BookMetadataProvider interface {
+	LookupISBN(ctx context.Context, isbn string) (*Metadata, error)
+}
+
+// NormalizeISBN removes the separators of an ISBN and validates its check
+// digit.
+func NormalizeISBN(value string) (string, error) {
+	isbn := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(value)))
+
+	switch len(isbn) {
+	case 10:
+		sum := 0
+		for i, c := range isbn {
+			digit := int(c - '0')
+			if c == 'X' && i == 9 {
+				digit = 10
+			} else if c < '0' || c > '9' {
+				return "", ErrInvalidISBN
+			}
+			sum += digit * (10 - i)
+		}
+		if sum%11 != 0 {
+			return "", ErrInvalidISBN
+		}
+	case 13:
+		sum := 0
+		for i, c := range isbn {
+			if c < '0' || c > '9' {
+				return "", ErrInvalidISBN
+			}
+			weight := 1
+			if i%2 == 1 {
+				weight = 3
+			}
+			sum += int(c-'0') * weight
+		}
+		if sum%10 != 0 {
+			return "", ErrInvalidISBN
+		}
+	default:
+		return "", ErrInvalidISBN
+	}
+
+	return isbn, nil
+}
+
+// OpenLibrary reads the Open Library API. BaseURL is usually
+// https://openlibrary.org and can point to any server with the same format.
+type OpenLibrary struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+const DefaultOpenLibraryURL = "https://openlibrary.org"
+
+func NewOpenLibrary(baseURL string) *OpenLibrary {
+	if baseURL == "" {
+		baseURL = DefaultOpenLibraryURL
+	}
+
+	return &OpenLibrary{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		Client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type openLibraryRef struct {
+	Key string `json:"key"`
+}
+
+// openLibraryText is a field that is either a string or {"type", "value"}.
+type openLibraryText string
+
+func (t *openLibraryText) UnmarshalJSON(raw []byte) error {
+	var value string
+	if err := json.Unmarshal(raw, &value); err == nil {
+		*t = openLibraryText(value)
+		return nil
+	}
+
+	var typed struct {
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &typed); err != nil {
+		return err
+	}
+
+	*t = openLibraryText(typed.Value)
+	return nil
+}
+
+type openLibraryEdition struct {
+	Title         string           `json:"title"`
+	Subtitle      string           `json:"subtitle"`
+	Description   openLibraryText  `json:"description"`
+	NumberOfPages int              `json:"number_of_pages"`
+	Languages     []openLibraryRef `json:"languages"`
+	Authors       []openLibraryRef `json:"authors"`
+	Works         []openLibraryRef `json:"works"`
+}
+
+type openLibraryWork struct {
+	Description openLibraryText `json:"description"`
+	Authors     []struct {
+		Author openLibraryRef `json:"author"`
+	} `json:"authors"`
+}
+
+// maxAuthors bounds the requests made for the names of the authors.
+const maxAuthors = 3
+
+// LookupISBN reads the edition of the ISBN, then its work when the edition
+// has no description or authors, and the names of the authors.
+func (o *OpenLibrary) LookupISBN(ctx context.Context, isbn string) (*Metadata, error) {
+	var edition openLibraryEdition
+	err := o.get(ctx, "/isbn/"+url.PathEscape(isbn)+".json", &edition)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := Metadata{
+		ISBN:        isbn,
+		Title:       edition.Title,
+		Description: string(edition.Description),
+		Pages:       edition.NumberOfPages,
+		Authors:     []string{},
+	}
+
+	if edition.Subtitle != "" {
+		metadata.Title += ": " + edition.Subtitle
+	}
+
+	for _, language := range edition.Languages {
+		if code, ok := languageCodes[strings.TrimPrefix(language.Key, "/languages/")]; ok {
+			metadata.Language = code
+			break
+		}
+	}
+
+	authors := edition.Authors
+	if len(edition.Works) > 0 && (metadata.Description == "" || len(authors) == 0) {
+		var work openLibraryWork
+		err := o.get(ctx, edition.Works[0].Key+".json", &work)
+		if err != nil && !errors.Is(err, ErrBookNotFound) {
+			return nil, err
+		}
+
+		if metadata.Description == "" {
+			metadata.Description = string(work.Description)
+		}
+		if len(authors) == 0 {
+			for _, author := range work.Authors {
+				authors = append(authors, author.Author)
+			}
+		}
+	}
+
+	for i, author := range authors {
+		if i == maxAuthors {
+			break
+		}
+
+		var name struct {
+			Name string `json:"name"`
+		}
+		err := o.get(ctx, author.Key+".json", &name)
+		if err != nil {
+			if errors.Is(err, ErrBookNotFound) {
+				continue
+			}
+			return nil, err
+		}
+
+		if name.Name != "" {
+			metadata.Authors = append(metadata.Authors, name.Name)
+		}
+	}
+
+	return &metadata, nil
+}
+
+func (o *OpenLibrary) get(ctx context.Context, path string, dst any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.BaseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := o.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return ErrBookNotFound
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("open library: unexpected status %d for %s", res.StatusCode, path)
+	}
+
+	return json.NewDecoder(res.Body).Decode(dst)
+}
+
+// languageCodes maps the MARC codes of Open Library to two letter codes.
+var languageCodes = map[string]string{
+	"eng": "en", "por": "pt", "spa": "es", "fre": "fr", "ger": "de", "ita": "it",
+	"jpn": "ja", "chi": "zh", "kor": "ko", "rus": "ru", "dut": "nl", "swe": "sv",
+	"nor": "no", "dan": "da", "fin": "fi", "pol": "pl", "tur": "tr", "ara": "ar",
+	"heb": "he", "gre": "el", "cze": "cs", "hun": "hu", "rum": "ro", "ukr": "uk",
+	"cat": "ca", "hin": "hi", "ind": "id", "vie": "vi", "tha": "th", "lat": "la",
+}
+
+// Cached keeps the books found by a provider in Redis. Missing books are not
+// cached, they may be added to the provider later. The cache is only a
+// shortcut: its errors are logged and the provider answers instead.
+type Cached struct {
+	Provider BookMetadataProvider
+	RDB      *redis.Client
+	TTL      time.Duration
+	Log      *jsonlog.Logger
+}
+
+func NewCached(provider BookMetadataProvider, rdb *redis.Client, ttl time.Duration, log *jsonlog.Logger) *Cached {
+	return &Cached{Provider: provider, RDB: rdb, TTL: ttl, Log: log}
+}
+
+func (c *Cached) LookupISBN(ctx context.Context, isbn string) (*Metadata, error) {
+	key := "books:isbn:" + isbn
+
+	cache, err := c.RDB.Get(ctx, key).Result()
+	switch {
+	case err == nil:
+		var metadata Metadata
+		err := json.Unmarshal([]byte(cache), &metadata)
+		if err == nil {
+			return &metadata, nil
+		}
+	case err != redis.Nil:
+		c.Log.PrintError(err, map[string]string{"isbn": isbn})
+	}
+
+	metadata, err := c.Provider.LookupISBN(ctx, isbn)
+	if err != nil {
+		return nil, err
+	}
+
+	bytes, err := json.Marshal(metadata)
+	if err != nil {
+		return metadata, nil
+	}
+
+	err = c.RDB.Set(ctx, key, bytes, c.TTL).Err()
+	if err != nil {
+		c.Log.PrintError(err, map[string]string{"isbn": isbn})
+	}
+
+	return metadata, nil
+}
@@ -0,0 +1,138 @@
+package bookmeta
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeISBN(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+		err   error
+	}{
+		{"978-0-306-40615-7", "9780306406157", nil},
+		{" 9780306406157 ", "9780306406157", nil},
+		{"0-306-40615-2", "0306406152", nil},
+		{"080442957x", "080442957X", nil},
+		{"978-0-306-40615-8", "", ErrInvalidISBN},
+		{"0-306-40615-3", "", ErrInvalidISBN},
+		{"X306406152", "", ErrInvalidISBN},
+		{"97803064061A7", "", ErrInvalidISBN},
+		{"12345", "", ErrInvalidISBN},
+		{"", "", ErrInvalidISBN},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := NormalizeISBN(tt.value)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("isbn = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// fixture serves the Open Library documents by path, anything else is a 404.
+func fixture(t *testing.T, documents map[string]string) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		document, ok := documents[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(document))
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestOpenLibraryLookupISBN(t *testing.T) {
+	server := fixture(t, map[string]string{
+		"/isbn/9780306406157.json": `{
+			"title": "O Alienista",
+			"subtitle": "Edição anotada",
+			"number_of_pages": 96,
+			"languages": [{"key": "/languages/por"}],
+			"works": [{"key": "/works/OL1W"}]
+		}`,
+		"/works/OL1W.json": `{
+			"description": {"type": "/type/text", "value": "A doctor opens an asylum in Itaguaí."},
+			"authors": [{"author": {"key": "/authors/OL1A"}}, {"author": {"key": "/authors/OL404A"}}]
+		}`,
+		"/authors/OL1A.json": `{"name": "Machado de Assis"}`,
+	})
+
+	metadata, err := NewOpenLibrary(server.URL).LookupISBN(context.Background(), "9780306406157")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := &Metadata{
+		ISBN:        "9780306406157",
+		Title:       "O Alienista: Edição anotada",
+		Authors:     []string{"Machado de Assis"},
+		Description: "A doctor opens an asylum in Itaguaí.",
+		Pages:       96,
+		Language:    "pt",
+	}
+	if !reflect.DeepEqual(metadata, want) {
+		t.Errorf("metadata = %+v, want %+v", metadata, want)
+	}
+}
+
+func TestOpenLibraryEditionAuthors(t *testing.T) {
+	// an edition with its own description and authors does not read its work
+	server := fixture(t, map[string]string{
+		"/isbn/0306406152.json": `{
+			"title": "Der Prozess",
+			"description": "Josef K. is arrested one morning.",
+			"languages": [{"key": "/languages/ger"}],
+			"authors": [{"key": "/authors/OL2A"}],
+			"works": [{"key": "/works/OL2W"}]
+		}`,
+		"/authors/OL2A.json": `{"name": "Franz Kafka"}`,
+	})
+
+	metadata, err := NewOpenLibrary(server.URL).LookupISBN(context.Background(), "0306406152")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if metadata.Description != "Josef K. is arrested one morning." || metadata.Language != "de" {
+		t.Errorf("metadata = %+v", metadata)
+	}
+	if !reflect.DeepEqual(metadata.Authors, []string{"Franz Kafka"}) {
+		t.Errorf("authors = %v", metadata.Authors)
+	}
+}
+
+func TestOpenLibraryErrors(t *testing.T) {
+	server := fixture(t, map[string]string{})
+
+	_, err := NewOpenLibrary(server.URL).LookupISBN(context.Background(), "9780306406157")
+	if !errors.Is(err, ErrBookNotFound) {
+		t.Errorf("error = %v, want %v", err, ErrBookNotFound)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	_, err = NewOpenLibrary(failing.URL).LookupISBN(context.Background(), "9780306406157")
+	if err == nil || errors.Is(err, ErrBookNotFound) {
+		t.Errorf("error = %v, want an unexpected status error", err)
+	}
+}
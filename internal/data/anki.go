@@ -4,7 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"strings"
+	"language-tracker/internal/streaks"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -24,6 +24,7 @@ type Anki struct {
 	Time           string    `json:"time"`
 	TargetLanguage string    `json:"target_language"`
 	CreatedAt      time.Time `json:"created_at"`
+	Date           time.Time `json:"date"`
 	Kind           string    `json:"source"`
 }
 
@@ -39,8 +40,8 @@ var (
 	ErrAnkiNotFound = errors.New("Anki item not found: The requested Anki item could not be found in the database.")
 )
 
-func (t AnkiModel) Insert(user string, reviewed int, newCards int, interval int, targetLanguage string) error {
-	query := "INSERT INTO anki(id_user, reviewed, added_cards, time, target_language) VALUES($1,$2,$3,$4,$5)"
+func (t AnkiModel) Insert(user string, reviewed int, newCards int, interval int, targetLanguage string, activityAt *time.Time) error {
+	query := "INSERT INTO anki(id_user, reviewed, added_cards, time, target_language, activity_at) VALUES($1,$2,$3,$4,$5,COALESCE($6, CURRENT_TIMESTAMP))"
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -52,7 +53,7 @@ func (t AnkiModel) Insert(user string, reviewed int, newCards int, interval int,
 
 	defer tx.Rollback(ctx)
 
-	args := []any{user, reviewed, newCards, ParseMinutes(int32(interval)), targetLanguage}
+	args := []any{user, reviewed, newCards, ParseMinutes(int32(interval)), targetLanguage, activityAt}
 
 	_, err = tx.Exec(ctx, query, args...)
 	if err != nil {
@@ -69,8 +70,10 @@ func (t AnkiModel) Insert(user string, reviewed int, newCards int, interval int,
 	return nil
 }
 
-func (t AnkiModel) GetByUser(user string) (*AnkiData, error) {
-	query := "SELECT id, time::interval, target_language, created_at, SUM(reviewed::int) OVER (PARTITION BY reviewed::int) as totalReviewed, SUM(time::interval) OVER (PARTITION BY time) AS sum_time, SUM(added_cards::integer) OVER (PARTITION BY added_cards) as totalAdded FROM anki WHERE id_user = $1 ORDER BY created_at ASC"
+func (t AnkiModel) GetByUser(u *User) (*AnkiData, error) {
+	user := u.Id.String()
+
+	query := "SELECT id, time::interval, target_language, created_at, activity_at, SUM(reviewed::int) OVER (PARTITION BY reviewed::int) as totalReviewed, SUM(time::interval) OVER (PARTITION BY time) AS sum_time, SUM(added_cards::integer) OVER (PARTITION BY added_cards) as totalAdded FROM anki WHERE id_user = $1 ORDER BY activity_at ASC"
 
 	cache, err := t.RDB.Get(context.Background(), "anki:user:"+user).Result()
 	if err != nil && err != redis.Nil {
@@ -83,6 +86,7 @@ func (t AnkiModel) GetByUser(user string) (*AnkiData, error) {
 		if err != nil {
 			return nil, err
 		}
+		data.DaysAnki = ankiStreak(u, data.Anki)
 		return &data, nil
 	}
 
@@ -106,7 +110,7 @@ func (t AnkiModel) GetByUser(user string) (*AnkiData, error) {
 	for rows.Next() {
 		var a Anki
 		var t time.Duration
-		err := rows.Scan(&a.ID, &t, &a.TargetLanguage, &a.CreatedAt, &a.Reviewed, &totalTime, &a.AddedCards)
+		err := rows.Scan(&a.ID, &t, &a.TargetLanguage, &a.CreatedAt, &a.Date, &a.Reviewed, &totalTime, &a.AddedCards)
 		if err != nil {
 			return nil, err
 		}
@@ -123,19 +127,6 @@ func (t AnkiModel) GetByUser(user string) (*AnkiData, error) {
 		return nil, err
 	}
 
-	var count int32 = 0
-	for i := 1; i < len(ankis); i++ {
-		splited := strings.Split(ankis[i].CreatedAt.String(), " ")[0]
-		splitb := strings.Split(ankis[i-1].CreatedAt.String(), " ")[0]
-
-		splitedP1, _ := time.Parse("2006-01-02", splited)
-		splitbP1, _ := time.Parse("2006-01-02", splitb)
-
-		if splitedP1.Sub(splitbP1) == 24*time.Hour {
-			count++
-		}
-	}
-
 	data.Anki = ankis
 
 	if len(ankis) == 0 {
@@ -145,7 +136,6 @@ func (t AnkiModel) GetByUser(user string) (*AnkiData, error) {
 	}
 
 	data.TotalTimeInSeconds = FormatTime(totalTime)
-	data.DaysAnki = count
 	bytes, err := json.Marshal(data)
 	if err != nil {
 		return nil, err
@@ -155,9 +145,63 @@ func (t AnkiModel) GetByUser(user string) (*AnkiData, error) {
 		return nil, err
 	}
 
+	data.DaysAnki = ankiStreak(u, data.Anki)
+
 	return &data, nil
 }
 
+// ankiStreak is the current streak of reviews in the timezone of the user.
+func ankiStreak(user *User, ankis []Anki) int32 {
+	loc := user.Configs.Location()
+
+	dates := make([]time.Time, 0, len(ankis))
+	for _, a := range ankis {
+		if !a.Date.IsZero() {
+			dates = append(dates, a.Date.In(loc))
+		}
+	}
+
+	streak := streaks.Compute(dates, streaks.Options{
+		Today:           time.Now().In(loc),
+		FreezesPerMonth: int(user.Configs.StreakFreezes),
+	})
+
+	return int32(streak.Current)
+}
+
+func (t AnkiModel) Update(user *User, id int64, reviewed *int, newCards *int, minutes *int, targetLanguage *string) error {
+	query := `
+		UPDATE anki SET
+			reviewed = COALESCE($3, reviewed),
+			added_cards = COALESCE($4, added_cards),
+			time = COALESCE($5::time, time),
+			target_language = COALESCE($6, target_language)
+		WHERE id_user = $1 AND id = $2`
+
+	ctx := context.Background()
+
+	var interval *string
+	if minutes != nil {
+		parsed := ParseMinutes(int32(*minutes))
+		interval = &parsed
+	}
+
+	args := []any{user.Id.String(), id, reviewed, newCards, interval, targetLanguage}
+
+	result, err := t.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrAnkiNotFound
+	}
+
+	t.RDB.Del(ctx, "anki:user:"+user.Id.String())
+
+	return nil
+}
+
 func (t AnkiModel) Delete(user *User, id string) error {
 	query := "DELETE FROM anki WHERE id_user = $1 AND id = $2"
 
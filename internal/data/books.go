@@ -5,9 +5,11 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"math"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
 )
@@ -15,6 +17,30 @@ import (
 var (
 	ErrPageNumberTooLow  = errors.New("The actual page number is less than the number of pages read")
 	ErrPageNumberTooHigh = errors.New("The actual page number exceeds the total number of pages")
+	ErrTotalPagesTooLow  = errors.New("The total number of pages is less than the pages already read")
+	ErrBookNotFound      = errors.New("Book not found: The requested book could not be found in the database.")
+	ErrHistoryNotFound   = errors.New("History not found: The requested history entry could not be found in the database.")
+	ErrPositionTooLow    = errors.New("The position is before the position already listened")
+	ErrPositionTooHigh   = errors.New("The position exceeds the duration of the audiobook")
+	ErrInvalidBookFormat = errors.New("The format must be one of paper, ebook, audiobook, manga or graded")
+)
+
+// The formats of a book. Audiobooks track a position in minutes instead of a
+// page: their history keeps it in actual_page and the duration in total_pages.
+const (
+	BookFormatPaper     = "paper"
+	BookFormatEbook     = "ebook"
+	BookFormatAudiobook = "audiobook"
+	BookFormatManga     = "manga"
+	BookFormatGraded    = "graded"
+)
+
+const (
+	// audiobookWordsPerMinute is a usual narration speed.
+	audiobookWordsPerMinute = 150
+	// mangaPageRatio is the part of the words of a prose page found in a page
+	// of manga or comics, most of it is drawings.
+	mangaPageRatio = 0.25
 )
 
 type BookModel struct {
@@ -23,27 +49,142 @@ type BookModel struct {
 }
 
 type DataBooks struct {
-	Books            []Book         `json:"books"`
-	BooksHistory     []BooksHistory `json:"booksHistory"`
-	BooksLastHistory []BooksHistory `json:"booksLastHistory"`
-	Kind             string         `json:"source"`
-	DurationBooks    time.Duration  `json:"-"`
-	TotalTimeBooks   string         `json:"totalTimeBooks"`
-	TotalBooksWords  int64          `json:"totalBooksWords"`
-	TotalBooksPages  int64          `json:"totalBooksPages"`
-	TotalBooks       int            `json:"totalBooks"`
+	Books              []Book         `json:"books"`
+	BooksHistory       []BooksHistory `json:"booksHistory"`
+	BooksLastHistory   []BooksHistory `json:"booksLastHistory"`
+	Kind               string         `json:"source"`
+	DurationBooks      time.Duration  `json:"-"`
+	TotalTimeBooks     string         `json:"totalTimeBooks"`
+	TotalBooksWords    int64          `json:"totalBooksWords"`
+	TotalBooksPages    int64          `json:"totalBooksPages"`
+	TotalReadingTime   string         `json:"totalReadingTime"`
+	TotalListeningTime string         `json:"totalListeningTime"`
+	TotalBooks         int            `json:"totalBooks"`
 }
 
 type Book struct {
 	ID             string    `json:"id"`
 	IDUser         string    `json:"-"`
 	Title          string    `json:"title"`
+	Author         *string   `json:"author"`
+	ISBN           *string   `json:"isbn"`
 	Description    *string   `json:"description"`
 	TargetLanguage string    `json:"target_language"`
+	Format         string    `json:"format"`
+	Level          *string   `json:"level"`
+	WordsPerPage   *int      `json:"words_per_page"`
+	WordCount      *int      `json:"word_count"`
+	TotalWords     int64     `json:"total_words"`
+	EstimatedTime  string    `json:"estimated_time"`
 	CreatedAt      time.Time `json:"created_at"`
 	Kind           string    `json:"source"`
 }
 
+// BookProfile is what is known about the words of a book: an exact count,
+// usually learned from its text, or the amount of words in a page. For
+// audiobooks a page is a minute.
+type BookProfile struct {
+	WordsPerPage *int
+	WordCount    *int
+	Format       string
+}
+
+// wordsPerPage prefers the exact count of the book, then its own words per
+// page and falls back to a default for the format: the average of the user for
+// prose, less for manga and the narration speed for audiobooks.
+func (p BookProfile) wordsPerPage(totalPages int64, user *User) float64 {
+	switch {
+	case p.WordCount != nil && totalPages > 0:
+		return float64(*p.WordCount) / float64(totalPages)
+	case p.WordsPerPage != nil:
+		return float64(*p.WordsPerPage)
+	case p.Format == BookFormatAudiobook:
+		return audiobookWordsPerMinute
+	case p.Format == BookFormatManga:
+		return float64(user.Configs.AverageWordsPerPage) * mangaPageRatio
+	default:
+		return float64(user.Configs.AverageWordsPerPage)
+	}
+}
+
+// ValidBookFormat reports whether format is one of the book formats.
+func ValidBookFormat(format string) bool {
+	switch format {
+	case BookFormatPaper, BookFormatEbook, BookFormatAudiobook, BookFormatManga, BookFormatGraded:
+		return true
+	}
+
+	return false
+}
+
+// progressErrors returns the errors of a progress going back or past the end
+// of a book, in pages or, for audiobooks, in minutes.
+func progressErrors(format string) (tooLow error, tooHigh error) {
+	if format == BookFormatAudiobook {
+		return ErrPositionTooLow, ErrPositionTooHigh
+	}
+
+	return ErrPageNumberTooLow, ErrPageNumberTooHigh
+}
+
+// estimate fills the words of the whole book and the time to read them at the
+// reading speed of the user, or the duration of an audiobook.
+func (b *Book) estimate(totalPages int64, user *User) {
+	profile := BookProfile{WordsPerPage: b.WordsPerPage, WordCount: b.WordCount, Format: b.Format}
+	b.TotalWords = int64(math.Round(profile.wordsPerPage(totalPages, user) * float64(totalPages)))
+
+	b.EstimatedTime = "00:00:00"
+	if b.Format == BookFormatAudiobook {
+		b.EstimatedTime = ParseTime(time.Duration(totalPages) * time.Minute)
+	} else if user.Configs.ReadWordsPerMinute > 0 {
+		b.EstimatedTime = ParseTime(time.Duration(float64(b.TotalWords) / float64(user.Configs.ReadWordsPerMinute) * float64(time.Minute)))
+	}
+}
+
+// BookInfo is the optional catalog information of a new book, usually found
+// by its ISBN. The format defaults to paper, the level is the one of graded
+// readers.
+type BookInfo struct {
+	ISBN        string
+	Author      string
+	Description string
+	Format      string
+	Level       string
+}
+
+// BookChapter is a chapter of an imported book, its text is only read by the
+// word tracking task.
+type BookChapter struct {
+	Title     string `json:"title"`
+	Content   string `json:"-"`
+	Words     int    `json:"words"`
+	StartPage int    `json:"start_page"`
+}
+
+// BookProgress is a reading progress that was recorded. Imported books know
+// their text, so the words of the pages read can be counted.
+type BookProgress struct {
+	Imported bool
+}
+
+// BookDetail is a book with its whole history. The speeds come from the pages
+// read and the reading time so far, the finish estimate from the pages read
+// per day since the book was started.
+type BookDetail struct {
+	Book
+	Unit            string         `json:"unit"`
+	History         []BooksHistory `json:"history"`
+	ActualPage      int64          `json:"actual_page"`
+	TotalPages      int64          `json:"total_pages"`
+	Progress        float64        `json:"progress"`
+	TotalTime       string         `json:"total_time"`
+	PagesPerHour    float64        `json:"pages_per_hour"`
+	WordsPerMinute  float64        `json:"words_per_minute"`
+	RemainingTime   *string        `json:"remaining_time"`
+	EstimatedFinish *time.Time     `json:"estimated_finish"`
+	Chapters        []BookChapter  `json:"chapters"`
+}
+
 type BooksHistory struct {
 	ID         int64         `json:"id"`
 	IDUser     string        `json:"-"`
@@ -55,12 +196,16 @@ type BooksHistory struct {
 	Time       string        `json:"time"`
 	TimeDiff   string        `json:"time_diff"`
 	CreatedAt  time.Time     `json:"created_at"`
+	Date       time.Time     `json:"date"`
 	RawTime    time.Duration `json:"-"`
 	Kind       string        `json:"source"`
 }
 
-func (b BookModel) Insert(user *User, title string, pages string, targetLanguage string, minutesReading int) error {
-	query := "INSERT INTO books(id_user, title, target_language) VALUES($1, $2, $3) RETURNING id"
+func (b BookModel) Insert(user *User, title string, pages string, targetLanguage string, minutesReading int, profile BookProfile, info BookInfo, activityAt *time.Time) error {
+	query := `
+		INSERT INTO books(id_user, title, target_language, words_per_page, word_count, isbn, author, description, format, level)
+		VALUES($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), NULLIF($8, ''), COALESCE(NULLIF($9, ''), 'paper'), NULLIF($10, ''))
+		RETURNING id`
 
 	ctx := context.Background()
 
@@ -71,18 +216,16 @@ func (b BookModel) Insert(user *User, title string, pages string, targetLanguage
 
 	var idBook uuid.UUID
 
-	args := []any{user.Id.String(), title, targetLanguage}
+	args := []any{user.Id.String(), title, targetLanguage, profile.WordsPerPage, profile.WordCount, info.ISBN, info.Author, info.Description, info.Format, info.Level}
 	err = tx.QueryRow(ctx, query, args...).Scan(&idBook)
 	if err != nil {
 		return err
 	}
 
-	query = "INSERT INTO books_history(id_user, id_book, actual_page, total_pages, read_type, total_words, time) VALUES($1, $2, $3, $4, $5, $6, $7)"
+	query = "INSERT INTO books_history(id_user, id_book, actual_page, total_pages, read_type, total_words, time_diff, time, activity_at) VALUES($1, $2, $3, $4, $5, $6, $7, $7, COALESCE($8, CURRENT_TIMESTAMP))"
 
-	totalWords := user.Configs.ReadWordsPerMinute * user.Configs.AverageWordsPerPage
-	totalTime := minutesReading
-
-	args = []any{user.Id.String(), idBook, 0, pages, "None", totalWords, ParseMinutes(int32(totalTime))}
+	// nothing was read yet
+	args = []any{user.Id.String(), idBook, 0, pages, "None", 0, ParseMinutes(int32(minutesReading)), activityAt}
 
 	_, err = tx.Exec(ctx, query, args...)
 	if err != nil {
@@ -100,8 +243,8 @@ func (b BookModel) Insert(user *User, title string, pages string, targetLanguage
 }
 
 func (b BookModel) GetByUser(user *User) (*DataBooks, error) {
-	query := "SELECT id, title, description, target_language, created_at FROM books WHERE id_user = $1"
-	queryHistory := "SELECT id,id_book,actual_page, total_pages, read_type, total_words, created_at, time::interval, time_diff::interval FROM books_history WHERE id_user = $1"
+	query := "SELECT id, title, author, isbn, description, target_language, format, level, words_per_page, word_count, created_at FROM books WHERE id_user = $1"
+	queryHistory := "SELECT id,id_book,actual_page, total_pages, read_type, total_words, created_at, activity_at, time::interval, time_diff::interval FROM books_history WHERE id_user = $1 ORDER BY id_book, activity_at, id"
 
 	ctx := context.Background()
 
@@ -133,7 +276,7 @@ func (b BookModel) GetByUser(user *User) (*DataBooks, error) {
 
 	for rows.Next() {
 		var b Book
-		err := rows.Scan(&b.ID, &b.Title, &b.Description, &b.TargetLanguage, &b.CreatedAt)
+		err := rows.Scan(&b.ID, &b.Title, &b.Author, &b.ISBN, &b.Description, &b.TargetLanguage, &b.Format, &b.Level, &b.WordsPerPage, &b.WordCount, &b.CreatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -153,7 +296,7 @@ func (b BookModel) GetByUser(user *User) (*DataBooks, error) {
 		b := BooksHistory{}
 		var rawTimeString time.Duration
 		var rawTimeDiff sql.NullString
-		err := rows.Scan(&b.ID, &b.IDBook, &b.ActualPage, &b.TotalPages, &b.ReadType, &b.TotalWords, &b.CreatedAt, &rawTimeString, &rawTimeDiff)
+		err := rows.Scan(&b.ID, &b.IDBook, &b.ActualPage, &b.TotalPages, &b.ReadType, &b.TotalWords, &b.CreatedAt, &b.Date, &rawTimeString, &rawTimeDiff)
 		if err != nil {
 			return nil, err
 		}
@@ -169,31 +312,57 @@ func (b BookModel) GetByUser(user *User) (*DataBooks, error) {
 		booksHistory = append(booksHistory, b)
 	}
 
+	// the history is in reading order, so the last entry of a book is its latest
 	lastHistoryMap := make(map[string]BooksHistory)
 
 	for _, b := range booksHistory {
 		lastHistoryMap[b.IDBook] = b
 	}
 
-	for _, a := range lastHistoryMap {
+	formats := make(map[string]string)
+	for _, book := range books {
+		formats[book.ID] = book.Format
+	}
+
+	var listening time.Duration
+	for _, h := range booksHistory {
+		a, ok := lastHistoryMap[h.IDBook]
+		if !ok || a.ID != h.ID {
+			continue
+		}
+
 		t, _ := ParseDuration(a.Time)
 		data.BooksLastHistory = append(data.BooksLastHistory, a)
 		data.DurationBooks += t.Abs()
 		data.TotalBooksWords += a.TotalWords
-		data.TotalBooksPages += a.ActualPage
+
+		// audiobooks are listening input and their positions are not pages
+		if formats[a.IDBook] == BookFormatAudiobook {
+			listening += t.Abs()
+		} else {
+			data.TotalBooksPages += a.ActualPage
+		}
+	}
+
+	for i := range books {
+		books[i].estimate(lastHistoryMap[books[i].ID].TotalPages, user)
 	}
 
 	data.Books = books
 	data.BooksHistory = booksHistory
 	data.TotalTimeBooks = ParseTime(data.DurationBooks)
+	data.TotalReadingTime = ParseTime(data.DurationBooks - listening)
+	data.TotalListeningTime = ParseTime(listening)
 	data.TotalBooks = len(books)
 
 	if len(books) == 0 {
 		data = DataBooks{
-			Books:            make([]Book, 1),
-			BooksHistory:     make([]BooksHistory, 1),
-			BooksLastHistory: make([]BooksHistory, 1),
-			TotalTimeBooks:   "00:00:00",
+			Books:              make([]Book, 1),
+			BooksHistory:       make([]BooksHistory, 1),
+			BooksLastHistory:   make([]BooksHistory, 1),
+			TotalTimeBooks:     "00:00:00",
+			TotalReadingTime:   "00:00:00",
+			TotalListeningTime: "00:00:00",
 		}
 	}
 
@@ -215,9 +384,357 @@ func (b BookModel) GetByUser(user *User) (*DataBooks, error) {
 	return &data, nil
 }
 
-func (b BookModel) UpdateBook(user *User, idBook string, readPages int, readType string, minutesReading int) error {
-	query := "INSERT INTO books_history(id_user, id_book, actual_page, read_type, total_words, time_diff, time, total_pages) VALUES($1, $2, $3, $4, $5, $6, $7, $8)"
-	queryHistory := "SELECT actual_page, total_pages, time::interval FROM books_history WHERE id_user = $1 AND id_book = $2 ORDER BY created_at DESC LIMIT 1"
+// Import creates a book from its chapters. The pages are counted with the
+// words per page of the user and the exact amount of words is kept as the
+// profile of the book.
+func (b BookModel) Import(user *User, title string, author string, targetLanguage string, chapters []BookChapter) (string, error) {
+	query := "INSERT INTO books(id_user, title, author, target_language, word_count, format) VALUES($1, $2, NULLIF($3, ''), $4, $5, 'ebook') RETURNING id"
+	queryHistory := "INSERT INTO books_history(id_user, id_book, actual_page, total_pages, read_type, total_words, time) VALUES($1, $2, 0, $3, 'None', 0, '00:00:00')"
+	queryChapters := `
+		INSERT INTO book_chapters(id_book, position, title, content, words)
+		SELECT $1, c.position, c.title, c.content, c.words
+		FROM unnest($2::text[], $3::text[], $4::int[]) WITH ORDINALITY AS c(title, content, words, position)`
+
+	titles := make([]string, len(chapters))
+	contents := make([]string, len(chapters))
+	words := make([]int32, len(chapters))
+	wordCount := 0
+	for i, chapter := range chapters {
+		titles[i] = chapter.Title
+		contents[i] = chapter.Content
+		words[i] = int32(chapter.Words)
+		wordCount += chapter.Words
+	}
+
+	totalPages := 1
+	if user.Configs.AverageWordsPerPage > 0 {
+		totalPages = int(math.Ceil(float64(wordCount) / float64(user.Configs.AverageWordsPerPage)))
+	}
+	if totalPages < 1 {
+		totalPages = 1
+	}
+
+	ctx := context.Background()
+
+	tx, err := b.DB.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var idBook string
+	err = tx.QueryRow(ctx, query, user.Id.String(), title, author, targetLanguage, wordCount).Scan(&idBook)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec(ctx, queryHistory, user.Id.String(), idBook, totalPages)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec(ctx, queryChapters, idBook, titles, contents, words)
+	if err != nil {
+		return "", err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	b.RDB.Del(ctx, "books:user:"+user.Id.String())
+
+	return idBook, nil
+}
+
+// ReadingImport is a book found in the history of an e-reader, with what was
+// read of it each day.
+type ReadingImport struct {
+	Title      string
+	Author     string
+	Language   string
+	TotalPages int
+	Days       []ReadingDay
+}
+
+type ReadingDay struct {
+	Date     time.Time
+	Page     int
+	Duration time.Duration
+}
+
+type ReadingImportResult struct {
+	BooksCreated   int      `json:"books_created"`
+	BooksMatched   int      `json:"books_matched"`
+	EntriesAdded   int      `json:"entries_added"`
+	EntriesSkipped int      `json:"entries_skipped"`
+	Books          []string `json:"-"`
+}
+
+// ImportReadings backfills the history of the books read on an e-reader.
+// Books are matched by title or created in their language, falling back to
+// targetLanguage. Each day becomes a history entry keyed by the source and the
+// date, so importing the same file again skips the days already imported.
+func (b BookModel) ImportReadings(user *User, source string, targetLanguage string, readings []ReadingImport) (*ReadingImportResult, error) {
+	queryBook := `
+		SELECT b.id, COALESCE(MAX(bh.total_pages), 0)
+		FROM books b
+		LEFT JOIN books_history bh ON bh.id_book = b.id
+		WHERE b.id_user = $1 AND LOWER(b.title) = LOWER($2)
+		GROUP BY b.id
+		ORDER BY MIN(b.created_at)
+		LIMIT 1`
+	queryInsertBook := "INSERT INTO books(id_user, title, author, target_language, format) VALUES($1, $2, NULLIF($3, ''), $4, 'ebook') RETURNING id"
+	queryTotalPages := "UPDATE books_history SET total_pages = $3 WHERE id_user = $1 AND id_book = $2 AND total_pages < $3"
+	queryHistory := `
+		INSERT INTO books_history(id_user, id_book, actual_page, total_pages, read_type, total_words, time_diff, time, activity_at, import_key)
+		VALUES($1, $2, $3, $4, 'None', 0, $5, $5, $6, $7)
+		ON CONFLICT (id_book, import_key) WHERE import_key IS NOT NULL DO NOTHING`
+	// the pages read up to a date and the lowest page read after it
+	queryPages := `
+		SELECT
+			COALESCE(MAX(actual_page) FILTER (WHERE activity_at <= $3), 0),
+			COALESCE(MIN(actual_page) FILTER (WHERE activity_at > $3), $4)
+		FROM books_history
+		WHERE id_user = $1 AND id_book = $2`
+
+	ctx := context.Background()
+	loc := user.Configs.Location()
+
+	tx, err := b.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	result := ReadingImportResult{}
+
+	for _, reading := range readings {
+		var idBook string
+		var totalPages int
+
+		err := tx.QueryRow(ctx, queryBook, user.Id.String(), reading.Title).Scan(&idBook, &totalPages)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			language := reading.Language
+			if language == "" {
+				language = targetLanguage
+			}
+
+			err = tx.QueryRow(ctx, queryInsertBook, user.Id.String(), reading.Title, reading.Author, language).Scan(&idBook)
+			if err != nil {
+				return nil, err
+			}
+			result.BooksCreated++
+		case err != nil:
+			return nil, err
+		default:
+			result.BooksMatched++
+		}
+
+		result.Books = append(result.Books, idBook)
+
+		totalPages = max(totalPages, reading.TotalPages)
+		for _, day := range reading.Days {
+			totalPages = max(totalPages, day.Page)
+		}
+
+		_, err = tx.Exec(ctx, queryTotalPages, user.Id.String(), idBook, totalPages)
+		if err != nil {
+			return nil, err
+		}
+
+		// the days are placed among the entries already in the history, so the
+		// pages never go back: a day starts from the page read before it and
+		// stops at the page of the entries after it. The running time is
+		// recomputed with the other entries of the book.
+		for _, day := range reading.Days {
+			var before, after int
+			err := tx.QueryRow(ctx, queryPages, user.Id.String(), idBook, day.Date, totalPages).Scan(&before, &after)
+			if err != nil {
+				return nil, err
+			}
+
+			actualPage := min(max(before, day.Page), after)
+
+			// the key is the calendar day of the user, the one the readings were grouped by
+			importKey := source + ":" + day.Date.In(loc).Format(time.DateOnly)
+			args := []any{user.Id.String(), idBook, actualPage, totalPages, ParseMinutes(int32(day.Duration.Minutes())), day.Date, importKey}
+
+			inserted, err := tx.Exec(ctx, queryHistory, args...)
+			if err != nil {
+				return nil, err
+			}
+
+			if inserted.RowsAffected() == 0 {
+				result.EntriesSkipped++
+			} else {
+				result.EntriesAdded++
+			}
+		}
+
+		err = checkBookPages(ctx, tx, user, idBook)
+		if err != nil {
+			return nil, err
+		}
+
+		err = recomputeBookHistory(ctx, tx, user, idBook)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	b.RDB.Del(ctx, "books:user:"+user.Id.String())
+
+	return &result, nil
+}
+
+// Get returns a book of the user with its history and reading statistics.
+func (b BookModel) Get(user *User, idBook string) (*BookDetail, error) {
+	query := "SELECT id, title, author, isbn, description, target_language, format, level, words_per_page, word_count, created_at FROM books WHERE id_user = $1 AND id = $2"
+	queryChapters := "SELECT title, words FROM book_chapters WHERE id_book = $1 ORDER BY position"
+	queryHistory := "SELECT id, id_book, actual_page, total_pages, read_type, total_words, created_at, activity_at, time::interval, time_diff::interval FROM books_history WHERE id_user = $1 AND id_book = $2 ORDER BY activity_at, id"
+
+	ctx := context.Background()
+
+	var book BookDetail
+
+	err := b.DB.QueryRow(ctx, query, user.Id.String(), idBook).Scan(&book.ID, &book.Title, &book.Author, &book.ISBN, &book.Description, &book.TargetLanguage, &book.Format, &book.Level, &book.WordsPerPage, &book.WordCount, &book.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrBookNotFound
+		}
+		return nil, err
+	}
+	book.Kind = "Books"
+
+	book.Unit = "pages"
+	if book.Format == BookFormatAudiobook {
+		book.Unit = "minutes"
+	}
+
+	rows, err := b.DB.Query(ctx, queryHistory, user.Id.String(), idBook)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	book.History = []BooksHistory{}
+	var readingTime time.Duration
+	var words int64
+	for rows.Next() {
+		h := BooksHistory{}
+		var timeDiff *time.Duration
+		err := rows.Scan(&h.ID, &h.IDBook, &h.ActualPage, &h.TotalPages, &h.ReadType, &h.TotalWords, &h.CreatedAt, &h.Date, &h.RawTime, &timeDiff)
+		if err != nil {
+			return nil, err
+		}
+
+		h.Time = ParseTime(h.RawTime)
+		h.TimeDiff = "00:00:00"
+		if timeDiff != nil {
+			h.TimeDiff = ParseTime(*timeDiff)
+			// the reading time is the sum of the sessions, a time of day can
+			// not hold more than 24 hours
+			readingTime += *timeDiff
+		}
+		h.Kind = "BooksHistory"
+
+		book.History = append(book.History, h)
+
+		// the history is ordered by date, the last entry holds the current totals
+		book.ActualPage = h.ActualPage
+		book.TotalPages = h.TotalPages
+		words = h.TotalWords
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	book.TotalTime = ParseTime(readingTime)
+	book.estimate(book.TotalPages, user)
+
+	rows, err = b.DB.Query(ctx, queryChapters, idBook)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	book.Chapters = []BookChapter{}
+	wordsPerPage := BookProfile{WordsPerPage: book.WordsPerPage, WordCount: book.WordCount, Format: book.Format}.wordsPerPage(book.TotalPages, user)
+	read := 0
+	for rows.Next() {
+		var c BookChapter
+		err := rows.Scan(&c.Title, &c.Words)
+		if err != nil {
+			return nil, err
+		}
+
+		c.StartPage = 1
+		if wordsPerPage > 0 {
+			c.StartPage = int(float64(read)/wordsPerPage) + 1
+		}
+		read += c.Words
+
+		book.Chapters = append(book.Chapters, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if book.TotalPages > 0 {
+		book.Progress = math.Round(float64(book.ActualPage)/float64(book.TotalPages)*10000) / 100
+	}
+
+	if readingTime > 0 && book.ActualPage > 0 {
+		book.PagesPerHour = math.Round(float64(book.ActualPage)/readingTime.Hours()*100) / 100
+		book.WordsPerMinute = math.Round(float64(words)/readingTime.Minutes()*100) / 100
+
+		remainingPages := book.TotalPages - book.ActualPage
+		remaining := ParseTime(time.Duration(float64(remainingPages) / book.PagesPerHour * float64(time.Hour)))
+		book.RemainingTime = &remaining
+	}
+
+	if len(book.History) > 0 && book.ActualPage > 0 && book.ActualPage < book.TotalPages {
+		days := time.Since(book.History[0].Date).Hours() / 24
+		if days < 1 {
+			days = 1
+		}
+
+		pagesPerDay := float64(book.ActualPage) / days
+		remainingDays := float64(book.TotalPages-book.ActualPage) / pagesPerDay
+
+		finish := time.Now().Add(time.Duration(remainingDays * 24 * float64(time.Hour)))
+		book.EstimatedFinish = &finish
+	}
+
+	return &book, nil
+}
+
+// Edit changes the book details, the nil values are kept. A new total of pages
+// is applied to the whole history, so the progress stays consistent, and the
+// words read are counted again from the profile of the book.
+func (b BookModel) Edit(user *User, idBook string, title *string, description *string, targetLanguage *string, totalPages *int, profile BookProfile, level *string) error {
+	query := `
+		UPDATE books SET
+			title = COALESCE($3, title),
+			description = COALESCE($4, description),
+			target_language = COALESCE($5, target_language),
+			words_per_page = COALESCE($6, words_per_page),
+			word_count = COALESCE($7, word_count),
+			format = COALESCE(NULLIF($8, ''), format),
+			level = COALESCE($9, level)
+		WHERE id_user = $1 AND id = $2`
+	queryPages := "SELECT COALESCE(MAX(actual_page), 0) FROM books_history WHERE id_user = $1 AND id_book = $2"
+	queryHistory := "UPDATE books_history SET total_pages = $3 WHERE id_user = $1 AND id_book = $2"
 
 	ctx := context.Background()
 
@@ -226,43 +743,153 @@ func (b BookModel) UpdateBook(user *User, idBook string, readPages int, readType
 		return err
 	}
 
-	args := []any{user.Id.String(), idBook}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, query, user.Id.String(), idBook, title, description, targetLanguage, profile.WordsPerPage, profile.WordCount, profile.Format, level)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrBookNotFound
+	}
+
+	if totalPages != nil {
+		var readPages int
+		err = tx.QueryRow(ctx, queryPages, user.Id.String(), idBook).Scan(&readPages)
+		if err != nil {
+			return err
+		}
+
+		if *totalPages < readPages {
+			return ErrTotalPagesTooLow
+		}
+
+		_, err = tx.Exec(ctx, queryHistory, user.Id.String(), idBook, *totalPages)
+		if err != nil {
+			return err
+		}
+	}
+
+	if totalPages != nil || profile.WordsPerPage != nil || profile.WordCount != nil || profile.Format != "" {
+		err = recountBookWords(ctx, tx, user, idBook)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return err
+	}
+
+	b.RDB.Del(ctx, "books:user:"+user.Id.String())
+
+	return nil
+}
+
+// recountBookWords sets the words read in each history entry of a book from
+// the current profile of the book.
+func recountBookWords(ctx context.Context, tx pgx.Tx, user *User, idBook string) error {
+	query := `
+		SELECT b.words_per_page, b.word_count, b.format, COALESCE(MAX(bh.total_pages), 0)
+		FROM books b
+		LEFT JOIN books_history bh ON bh.id_book = b.id
+		WHERE b.id_user = $1 AND b.id = $2
+		GROUP BY b.id`
+
+	var profile BookProfile
+	var totalPages int64
+
+	err := tx.QueryRow(ctx, query, user.Id.String(), idBook).Scan(&profile.WordsPerPage, &profile.WordCount, &profile.Format, &totalPages)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrBookNotFound
+		}
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE books_history SET total_words = ROUND(actual_page * $3::float8) WHERE id_user = $1 AND id_book = $2",
+		user.Id.String(), idBook, profile.wordsPerPage(totalPages, user))
+
+	return err
+}
+
+func (b BookModel) UpdateBook(user *User, idBook string, readPages int, readType string, minutesReading int, activityAt *time.Time) (*BookProgress, error) {
+	query := "INSERT INTO books_history(id_user, id_book, actual_page, read_type, total_words, time_diff, time, total_pages, activity_at) VALUES($1, $2, $3, $4, $5, $6, $7, $8, COALESCE($9, CURRENT_TIMESTAMP))"
+	queryHistory := "SELECT actual_page, total_pages, time::interval FROM books_history WHERE id_user = $1 AND id_book = $2 AND activity_at <= COALESCE($3, CURRENT_TIMESTAMP) ORDER BY activity_at DESC, id DESC LIMIT 1"
+	queryProfile := "SELECT words_per_page, word_count, format, EXISTS(SELECT 1 FROM book_chapters WHERE id_book = books.id) FROM books WHERE id_user = $1 AND id = $2"
+
+	ctx := context.Background()
+
+	tx, err := b.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	args := []any{user.Id.String(), idBook, activityAt}
 
 	var actualPage, totalPages int
 	var timeBook time.Duration
 
 	err = tx.QueryRow(ctx, queryHistory, args...).Scan(&actualPage, &totalPages, &timeBook)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	var profile BookProfile
+	progress := BookProgress{}
+	err = tx.QueryRow(ctx, queryProfile, user.Id.String(), idBook).Scan(&profile.WordsPerPage, &profile.WordCount, &profile.Format, &progress.Imported)
+	if err != nil {
+		return nil, err
+	}
+
+	tooLow, tooHigh := progressErrors(profile.Format)
 	if actualPage >= readPages {
-		return ErrPageNumberTooLow
+		return nil, tooLow
 	} else if readPages > totalPages {
-		return ErrPageNumberTooHigh
+		return nil, tooHigh
+	}
+
+	// without a listening time, the audiobook was listened at normal speed
+	if profile.Format == BookFormatAudiobook && minutesReading == 0 {
+		minutesReading = readPages - actualPage
 	}
 
-	totalWords := user.Configs.AverageWordsPerPage * int32(readPages)
+	totalWords := int64(math.Round(profile.wordsPerPage(int64(totalPages), user) * float64(readPages)))
 	timeBookInMinutes := timeBook.Minutes()
 	totalTime := minutesReading + int(timeBookInMinutes)
 
 	timeDiff := minutesReading
 
-	args = []any{user.Id.String(), idBook, readPages, readType, totalWords, ParseMinutes(int32(timeDiff)), ParseMinutes(int32(totalTime)), totalPages}
+	args = []any{user.Id.String(), idBook, readPages, readType, totalWords, ParseMinutes(int32(timeDiff)), time.Duration(totalTime) * time.Minute, totalPages, activityAt}
 
 	_, err = tx.Exec(ctx, query, args...)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	// an entry dated in the past changes the totals of the entries after it
+	err = checkBookPages(ctx, tx, user, idBook)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recomputeBookHistory(ctx, tx, user, idBook)
+	if err != nil {
+		return nil, err
 	}
 
 	b.RDB.Del(ctx, "books:user:"+user.Id.String())
 
 	err = tx.Commit(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return &progress, nil
 }
 
 func (b BookModel) Delete(user *User, idBook string) error {
@@ -292,29 +919,168 @@ func (b BookModel) Delete(user *User, idBook string) error {
 	return nil
 }
 
-func (b BookModel) DeleteHistory(user *User, idBook string) error {
-	query := "DELETE FROM books_history WHERE id_user = $1 AND id = $2"
+// DeleteHistory removes a history entry and recomputes the running totals of
+// the entries of the book after it. It returns the book of the entry.
+func (b BookModel) DeleteHistory(user *User, idHistory string) (string, error) {
+	query := "DELETE FROM books_history WHERE id_user = $1 AND id = $2 RETURNING id_book"
 
 	ctx := context.Background()
 
 	tx, err := b.DB.Begin(ctx)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	args := []any{user.Id.String(), idBook}
+	defer tx.Rollback(ctx)
 
-	_, err = tx.Exec(ctx, query, args...)
+	var idBook string
+	err = tx.QueryRow(ctx, query, user.Id.String(), idHistory).Scan(&idBook)
 	if err != nil {
-		return err
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrHistoryNotFound
+		}
+		return "", err
+	}
+
+	err = recomputeBookHistory(ctx, tx, user, idBook)
+	if err != nil {
+		return "", err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return "", err
 	}
 
 	b.RDB.Del(ctx, "books:user:"+user.Id.String())
 
+	return idBook, nil
+}
+
+// EditHistory changes a history entry. Only the fields given are updated, the
+// minutes are the reading time of the entry itself. The pages of the whole
+// book are checked again and the running totals recomputed.
+func (b BookModel) EditHistory(user *User, idHistory string, actualPage *int, minutesReading *int, readType *string, activityAt *time.Time) (*BooksHistory, error) {
+	query := `
+		UPDATE books_history SET
+			actual_page = COALESCE($3, actual_page),
+			time_diff = COALESCE($4::time, time_diff),
+			read_type = COALESCE($5, read_type),
+			activity_at = COALESCE($6, activity_at)
+		WHERE id_user = $1 AND id = $2
+		RETURNING id_book`
+	queryHistory := "SELECT id, id_book, actual_page, total_pages, read_type, total_words, created_at, activity_at, time::interval, time_diff::interval FROM books_history WHERE id = $1"
+
+	var timeDiff *string
+	if minutesReading != nil {
+		minutes := ParseMinutes(int32(*minutesReading))
+		timeDiff = &minutes
+	}
+
+	ctx := context.Background()
+
+	tx, err := b.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var idBook string
+	err = tx.QueryRow(ctx, query, user.Id.String(), idHistory, actualPage, timeDiff, readType, activityAt).Scan(&idBook)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrHistoryNotFound
+		}
+		return nil, err
+	}
+
+	err = checkBookPages(ctx, tx, user, idBook)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recomputeBookHistory(ctx, tx, user, idBook)
+	if err != nil {
+		return nil, err
+	}
+
+	h := BooksHistory{Kind: "BooksHistory"}
+	var rawTime, rawTimeDiff time.Duration
+	err = tx.QueryRow(ctx, queryHistory, idHistory).Scan(&h.ID, &h.IDBook, &h.ActualPage, &h.TotalPages, &h.ReadType, &h.TotalWords, &h.CreatedAt, &h.Date, &rawTime, &rawTimeDiff)
+	if err != nil {
+		return nil, err
+	}
+
+	h.Time = ParseTime(rawTime)
+	h.TimeDiff = ParseTime(rawTimeDiff)
+
 	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	b.RDB.Del(ctx, "books:user:"+user.Id.String())
+
+	return &h, nil
+}
+
+// checkBookPages verifies that, in reading order, the pages of a book, or the
+// position of an audiobook, never go back and never exceed the total.
+func checkBookPages(ctx context.Context, tx pgx.Tx, user *User, idBook string) error {
+	query := "SELECT actual_page, total_pages FROM books_history WHERE id_user = $1 AND id_book = $2 ORDER BY activity_at, id"
+
+	var format string
+	err := tx.QueryRow(ctx, "SELECT format FROM books WHERE id_user = $1 AND id = $2", user.Id.String(), idBook).Scan(&format)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	tooLow, tooHigh := progressErrors(format)
+
+	rows, err := tx.Query(ctx, query, user.Id.String(), idBook)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	previous := 0
+	for rows.Next() {
+		var actualPage, totalPages int
+		err := rows.Scan(&actualPage, &totalPages)
+		if err != nil {
+			return err
+		}
+
+		if actualPage < previous {
+			return tooLow
+		} else if actualPage > totalPages {
+			return tooHigh
+		}
+
+		previous = actualPage
+	}
+
+	return rows.Err()
+}
+
+// recomputeBookHistory sets the running reading time of each history entry of
+// a book, in reading order, from the time of the entries up to it, and the
+// words read from the pages.
+func recomputeBookHistory(ctx context.Context, tx pgx.Tx, user *User, idBook string) error {
+	query := `
+		UPDATE books_history bh SET time = s.total
+		FROM (
+			SELECT id, SUM(time_diff::interval) OVER (ORDER BY activity_at, id) AS total
+			FROM books_history
+			WHERE id_user = $1 AND id_book = $2
+		) s
+		WHERE bh.id = s.id AND bh.time IS DISTINCT FROM s.total`
+
+	_, err := tx.Exec(ctx, query, user.Id.String(), idBook)
+	if err != nil {
+		return err
+	}
+
+	return recountBookWords(ctx, tx, user, idBook)
 }
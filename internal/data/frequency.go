@@ -0,0 +1,229 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrFrequencyListNotFound = errors.New("no frequency list was imported for this language")
+)
+
+// CoverageBuckets are the top ranks reported by Coverage.
+var CoverageBuckets = []int{1000, 2000, 5000, 10000}
+
+type FrequencyModel struct {
+	DB  *pgxpool.Pool
+	RDB *redis.Client
+}
+
+type FrequencyList struct {
+	ID        int64     `json:"id"`
+	Language  string    `json:"language"`
+	Name      string    `json:"name"`
+	Shared    bool      `json:"shared"`
+	Size      int       `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Coverage struct {
+	Language string           `json:"language"`
+	List     FrequencyList    `json:"list"`
+	Buckets  []CoverageBucket `json:"buckets"`
+}
+
+type CoverageBucket struct {
+	Top         int              `json:"top"`
+	Words       int              `json:"words"`
+	Encountered int              `json:"encountered"`
+	Percentage  float64          `json:"percentage"`
+	Known       int              `json:"known"`
+	Exposure    CoverageExposure `json:"exposure"`
+}
+
+// CoverageExposure splits the encountered words by how many times they were seen.
+type CoverageExposure struct {
+	Once     int `json:"once"`     // seen a single time
+	Few      int `json:"few"`      // seen 2 to 9 times
+	Frequent int `json:"frequent"` // seen 10 times or more
+}
+
+// Import replaces the list of the owner for the language with the ranked
+// words, the first word being the most frequent. A nil user imports the list
+// shared with everyone.
+func (m FrequencyModel) Import(user *User, language string, name string, words []string) (*FrequencyList, error) {
+	deleteList := "DELETE FROM frequency_lists WHERE language = $1 AND id_user IS NOT DISTINCT FROM $2"
+	insertList := "INSERT INTO frequency_lists(id_user, language, name) VALUES($1, $2, $3) RETURNING id, created_at"
+	insertWords := `
+		INSERT INTO words(word)
+		SELECT word FROM unnest($1::text[]) AS word
+		ORDER BY word
+		ON CONFLICT (word) DO NOTHING`
+	insertRanks := `
+		INSERT INTO frequency_words(id_list, rank, word)
+		SELECT $1, i.rank, w.id
+		FROM unnest($2::text[]) WITH ORDINALITY AS i(word, rank)
+		INNER JOIN words w ON w.word = i.word`
+
+	ctx := context.Background()
+
+	var owner *string
+	if user != nil {
+		id := user.Id.String()
+		owner = &id
+	}
+
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, deleteList, language, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	list := FrequencyList{Language: language, Name: name, Shared: user == nil, Size: len(words)}
+
+	err = tx.QueryRow(ctx, insertList, owner, language, name).Scan(&list.ID, &list.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx, insertWords, words)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx, insertRanks, list.ID, words)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &list, nil
+}
+
+// GetByUser returns the lists the user can use, its own and the shared ones.
+func (m FrequencyModel) GetByUser(user *User) ([]FrequencyList, error) {
+	query := `
+		SELECT fl.id, fl.language, fl.name, fl.id_user IS NULL, COUNT(fw.rank), fl.created_at
+		FROM frequency_lists fl
+		LEFT JOIN frequency_words fw ON fw.id_list = fl.id
+		WHERE fl.id_user = $1 OR fl.id_user IS NULL
+		GROUP BY fl.id
+		ORDER BY fl.language, fl.id_user IS NULL`
+
+	rows, err := m.DB.Query(context.Background(), query, user.Id.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []FrequencyList{}
+	for rows.Next() {
+		var l FrequencyList
+		err := rows.Scan(&l.ID, &l.Language, &l.Name, &l.Shared, &l.Size, &l.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return lists, nil
+}
+
+// Delete removes a list of the user, admins can also remove the shared ones.
+func (m FrequencyModel) Delete(user *User, id int64) error {
+	query := "DELETE FROM frequency_lists WHERE id = $1 AND (id_user = $2 OR (id_user IS NULL AND $3))"
+
+	result, err := m.DB.Exec(context.Background(), query, id, user.Id.String(), user.IsAdmin)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrFrequencyListNotFound
+	}
+
+	return nil
+}
+
+// Coverage reports how many of the most frequent words of a language the user
+// already met, using the list of the user when there is one and the shared
+// list otherwise.
+func (m FrequencyModel) Coverage(user *User, language string) (*Coverage, error) {
+	queryList := `
+		SELECT fl.id, fl.name, fl.id_user IS NULL, fl.created_at, (SELECT COUNT(*) FROM frequency_words WHERE id_list = fl.id)
+		FROM frequency_lists fl
+		WHERE fl.language = $2 AND (fl.id_user = $1 OR fl.id_user IS NULL)
+		ORDER BY fl.id_user IS NULL
+		LIMIT 1`
+	query := `
+		SELECT
+			b.top,
+			COUNT(fw.rank),
+			COUNT(awa.id) FILTER (WHERE awa.amount > 0),
+			COUNT(awa.id) FILTER (WHERE awa.status = 'known'),
+			COUNT(awa.id) FILTER (WHERE awa.amount = 1),
+			COUNT(awa.id) FILTER (WHERE awa.amount BETWEEN 2 AND 9),
+			COUNT(awa.id) FILTER (WHERE awa.amount >= 10)
+		FROM unnest($4::int[]) AS b(top)
+		LEFT JOIN frequency_words fw ON fw.id_list = $3 AND fw.rank <= b.top
+		LEFT JOIN aux_words_amount awa ON awa.word = fw.word AND awa.id_user = $1 AND awa.language = $2
+		GROUP BY b.top
+		ORDER BY b.top`
+
+	ctx := context.Background()
+
+	coverage := Coverage{Language: language, Buckets: []CoverageBucket{}}
+	coverage.List.Language = language
+
+	err := m.DB.QueryRow(ctx, queryList, user.Id.String(), language).Scan(&coverage.List.ID, &coverage.List.Name, &coverage.List.Shared, &coverage.List.CreatedAt, &coverage.List.Size)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrFrequencyListNotFound
+		}
+		return nil, err
+	}
+
+	rows, err := m.DB.Query(ctx, query, user.Id.String(), language, coverage.List.ID, CoverageBuckets)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var b CoverageBucket
+		err := rows.Scan(&b.Top, &b.Words, &b.Encountered, &b.Known, &b.Exposure.Once, &b.Exposure.Few, &b.Exposure.Frequent)
+		if err != nil {
+			return nil, err
+		}
+
+		if b.Words > 0 {
+			b.Percentage = math.Round(float64(b.Encountered)/float64(b.Words)*10000) / 100
+		}
+
+		coverage.Buckets = append(coverage.Buckets, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &coverage, nil
+}
@@ -0,0 +1,389 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrJournalNotFound = errors.New("the specified journal entry could not be found")
+)
+
+type JournalModel struct {
+	DB  *pgxpool.Pool
+	RDB *redis.Client
+}
+
+// JournalEntry is a text the user wrote in the target language. NewWords are
+// the words used for the first time in it.
+type JournalEntry struct {
+	ID             string    `json:"id"`
+	Title          *string   `json:"title"`
+	Content        string    `json:"content"`
+	TargetLanguage string    `json:"target_language"`
+	TotalWords     int       `json:"total_words"`
+	DistinctWords  int       `json:"distinct_words"`
+	NewWords       int       `json:"new_words"`
+	Time           string    `json:"time"`
+	Date           time.Time `json:"date"`
+	CreatedAt      time.Time `json:"created_at"`
+	Kind           string    `json:"source"`
+}
+
+type JournalWord struct {
+	Word   string `json:"word"`
+	Amount int    `json:"amount"`
+}
+
+// ActiveVocabulary compares, for a language, the words the user produced in
+// the journal with the words met while reading and listening.
+type ActiveVocabulary struct {
+	Language      string  `json:"language"`
+	Produced      int     `json:"produced"`
+	Exposed       int     `json:"exposed"`
+	Known         int     `json:"known"`
+	ProducedKnown int     `json:"produced_known"`
+	ActiveRatio   float64 `json:"active_ratio"`
+}
+
+// journalFirstUse keeps the words of an entry j, with its words jw, that the
+// user did not write in an earlier entry of the same language.
+const journalFirstUse = `
+	NOT EXISTS (
+		SELECT 1
+		FROM journal_words jw2
+		INNER JOIN journal j2 ON j2.id = jw2.id_journal
+		WHERE j2.id_user = j.id_user AND j2.target_language = j.target_language AND jw2.word = jw.word
+		  AND (j2.activity_at, j2.created_at, j2.id) < (j.activity_at, j.created_at, j.id)
+	)`
+
+// Insert stores a journal entry with its word counts and adds them to the
+// words produced by the user.
+func (m JournalModel) Insert(user *User, title string, content string, targetLanguage string, minutes int, counts map[string]int, totalWords int, activityAt *time.Time) (*JournalEntry, error) {
+	query := `
+		INSERT INTO journal(id_user, title, content, target_language, total_words, distinct_words, time, activity_at)
+		VALUES($1, NULLIF($2, ''), $3, $4, $5, $6, $7, COALESCE($8, CURRENT_TIMESTAMP))
+		RETURNING id, activity_at, created_at`
+	insertWords := `
+		INSERT INTO words(word)
+		SELECT word FROM unnest($1::text[]) AS word
+		ORDER BY word
+		ON CONFLICT (word) DO NOTHING`
+	insertJournalWords := `
+		INSERT INTO journal_words(id_journal, word, amount)
+		SELECT $1::uuid, w.id, i.amount
+		FROM unnest($2::text[], $3::int[]) AS i(word, amount)
+		INNER JOIN words w ON w.word = i.word`
+	upsertProduced := `
+		INSERT INTO produced_words(id_user, word, language, amount, first_used_at, last_used_at)
+		SELECT $1::uuid, jw.word, $3::varchar, jw.amount, $4::timestamptz, $4::timestamptz
+		FROM journal_words jw
+		WHERE jw.id_journal = $2
+		ORDER BY jw.word
+		ON CONFLICT (id_user, language, word) DO UPDATE SET
+			amount = produced_words.amount + EXCLUDED.amount,
+			first_used_at = LEAST(produced_words.first_used_at, EXCLUDED.first_used_at),
+			last_used_at = GREATEST(produced_words.last_used_at, EXCLUDED.last_used_at)`
+	queryNew := `
+		SELECT COUNT(*)
+		FROM journal_words jw
+		INNER JOIN journal j ON j.id = jw.id_journal
+		WHERE j.id = $1 AND` + journalFirstUse
+
+	words := make([]string, 0, len(counts))
+	for word := range counts {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+
+	amounts := make([]int32, len(words))
+	for i, word := range words {
+		amounts[i] = int32(counts[word])
+	}
+
+	ctx := context.Background()
+
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	entry := JournalEntry{
+		Content:        content,
+		TargetLanguage: targetLanguage,
+		TotalWords:     totalWords,
+		DistinctWords:  len(words),
+		Time:           ParseMinutes(int32(minutes)),
+		Kind:           "Journal",
+	}
+	if title != "" {
+		entry.Title = &title
+	}
+
+	args := []any{user.Id.String(), title, content, targetLanguage, totalWords, len(words), entry.Time, activityAt}
+	err = tx.QueryRow(ctx, query, args...).Scan(&entry.ID, &entry.Date, &entry.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(words) > 0 {
+		_, err = tx.Exec(ctx, insertWords, words)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Exec(ctx, insertJournalWords, entry.ID, words, amounts)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.Exec(ctx, upsertProduced, user.Id.String(), entry.ID, targetLanguage, entry.Date)
+		if err != nil {
+			return nil, err
+		}
+
+		err = tx.QueryRow(ctx, queryNew, entry.ID).Scan(&entry.NewWords)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+// List returns the journal entries of the user, the latest first.
+func (m JournalModel) List(user *User, language string, limit int) ([]JournalEntry, error) {
+	query := `
+		SELECT j.id, j.title, j.content, j.target_language, j.total_words, j.distinct_words, j.time::interval, j.activity_at, j.created_at,
+			(SELECT COUNT(*) FROM journal_words jw WHERE jw.id_journal = j.id AND` + journalFirstUse + `)
+		FROM journal j
+		WHERE j.id_user = $1 AND ($2 = '' OR j.target_language = $2)
+		ORDER BY j.activity_at DESC, j.created_at DESC
+		LIMIT $3`
+
+	ctx := context.Background()
+
+	rows, err := m.DB.Query(ctx, query, user.Id.String(), language, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []JournalEntry{}
+	for rows.Next() {
+		e := JournalEntry{Kind: "Journal"}
+		var d time.Duration
+		err := rows.Scan(&e.ID, &e.Title, &e.Content, &e.TargetLanguage, &e.TotalWords, &e.DistinctWords, &d, &e.Date, &e.CreatedAt, &e.NewWords)
+		if err != nil {
+			return nil, err
+		}
+
+		e.Time = ParseTime(d)
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// NewWords returns the words of an entry that the user never wrote in an
+// earlier entry, the most used first.
+func (m JournalModel) NewWords(user *User, idJournal string) ([]JournalWord, error) {
+	queryEntry := "SELECT 1 FROM journal WHERE id_user = $1 AND id = $2"
+	query := `
+		SELECT w.word, jw.amount
+		FROM journal_words jw
+		INNER JOIN journal j ON j.id = jw.id_journal
+		INNER JOIN words w ON w.id = jw.word
+		WHERE j.id_user = $1 AND j.id = $2 AND` + journalFirstUse + `
+		ORDER BY jw.amount DESC, w.word`
+
+	ctx := context.Background()
+
+	var exists int
+	err := m.DB.QueryRow(ctx, queryEntry, user.Id.String(), idJournal).Scan(&exists)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrJournalNotFound
+		}
+		return nil, err
+	}
+
+	rows, err := m.DB.Query(ctx, query, user.Id.String(), idJournal)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	words := []JournalWord{}
+	for rows.Next() {
+		var w JournalWord
+		err := rows.Scan(&w.Word, &w.Amount)
+		if err != nil {
+			return nil, err
+		}
+		words = append(words, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return words, nil
+}
+
+// Delete removes a journal entry and its words from the produced words. The
+// dates of first and last use come again from the remaining entries.
+func (m JournalModel) Delete(user *User, idJournal string) error {
+	queryEntry := "SELECT target_language FROM journal WHERE id_user = $1 AND id = $2 FOR UPDATE"
+	decreaseProduced := `
+		UPDATE produced_words pw
+		SET amount = pw.amount - jw.amount
+		FROM journal_words jw
+		WHERE jw.id_journal = $2 AND pw.id_user = $1 AND pw.language = $3 AND pw.word = jw.word`
+	queryWords := "SELECT word FROM journal_words WHERE id_journal = $1"
+	queryDelete := "DELETE FROM journal WHERE id = $1"
+	deleteUnused := "DELETE FROM produced_words WHERE id_user = $1 AND language = $2 AND word = ANY($3) AND amount <= 0"
+	updateDates := `
+		UPDATE produced_words pw
+		SET first_used_at = s.first_used_at, last_used_at = s.last_used_at
+		FROM (
+			SELECT jw.word, MIN(j.activity_at) AS first_used_at, MAX(j.activity_at) AS last_used_at
+			FROM journal_words jw
+			INNER JOIN journal j ON j.id = jw.id_journal
+			WHERE j.id_user = $1 AND j.target_language = $2 AND jw.word = ANY($3)
+			GROUP BY jw.word
+		) s
+		WHERE pw.id_user = $1 AND pw.language = $2 AND pw.word = s.word`
+
+	ctx := context.Background()
+
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var language string
+	err = tx.QueryRow(ctx, queryEntry, user.Id.String(), idJournal).Scan(&language)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrJournalNotFound
+		}
+		return err
+	}
+
+	rows, err := tx.Query(ctx, queryWords, idJournal)
+	if err != nil {
+		return err
+	}
+
+	words := []int32{}
+	for rows.Next() {
+		var word int32
+		err := rows.Scan(&word)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		words = append(words, word)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, decreaseProduced, user.Id.String(), idJournal, language)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, queryDelete, idJournal)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, deleteUnused, user.Id.String(), language, words)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, updateDates, user.Id.String(), language, words)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ActiveVocabulary returns, per language, how many words the user produced
+// and how many were met, known or not, in the tracked input.
+func (m JournalModel) ActiveVocabulary(user *User, language string) ([]ActiveVocabulary, error) {
+	query := `
+		WITH produced AS (
+			SELECT language, COUNT(*) AS total
+			FROM produced_words
+			WHERE id_user = $1 AND ($2 = '' OR language = $2)
+			GROUP BY language
+		), exposed AS (
+			SELECT language, COUNT(*) AS total, COUNT(*) FILTER (WHERE status = 'known') AS known
+			FROM aux_words_amount
+			WHERE id_user = $1 AND ($2 = '' OR language = $2) AND status <> 'ignored'
+			GROUP BY language
+		), produced_known AS (
+			SELECT pw.language, COUNT(*) AS total
+			FROM produced_words pw
+			INNER JOIN aux_words_amount awa ON awa.id_user = pw.id_user AND awa.language = pw.language AND awa.word = pw.word
+			WHERE pw.id_user = $1 AND ($2 = '' OR pw.language = $2) AND awa.status = 'known'
+			GROUP BY pw.language
+		)
+		SELECT COALESCE(p.language, e.language), COALESCE(p.total, 0), COALESCE(e.total, 0), COALESCE(e.known, 0), COALESCE(pk.total, 0)
+		FROM produced p
+		FULL OUTER JOIN exposed e ON e.language = p.language
+		LEFT JOIN produced_known pk ON pk.language = p.language
+		ORDER BY 1`
+
+	ctx := context.Background()
+
+	rows, err := m.DB.Query(ctx, query, user.Id.String(), language)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vocabulary := []ActiveVocabulary{}
+	for rows.Next() {
+		var v ActiveVocabulary
+		err := rows.Scan(&v.Language, &v.Produced, &v.Exposed, &v.Known, &v.ProducedKnown)
+		if err != nil {
+			return nil, err
+		}
+
+		// the part of the known words the user also uses
+		if v.Known > 0 {
+			v.ActiveRatio = float64(v.ProducedKnown) / float64(v.Known)
+		}
+
+		vocabulary = append(vocabulary, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return vocabulary, nil
+}
@@ -6,16 +6,26 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
 )
 
+const (
+	MediaProcessing = "processing"
+	MediaDone       = "done"
+	MediaFailed     = "failed"
+)
+
 var (
-	InvalidUrl = errors.New("Invalid Youtube URL")
+	InvalidUrl       = errors.New("Invalid Youtube URL")
+	ErrMediaNotFound = errors.New("the specified media could not be found")
 )
 
 type MediasModel struct {
@@ -41,10 +51,45 @@ type Video struct {
 	Time           string         `json:"time"`
 	TargetLanguage string         `json:"target_language"`
 	CreatedAt      time.Time      `json:"created_at"`
+	Date           time.Time      `json:"date"`
 	TotalWords     int            `json:"total_words"`
+	Status         string         `json:"status"`
+	TaskError      *string        `json:"task_error"`
 	Kind           string         `json:"source"`
 }
 
+type MediaPreview struct {
+	TotalTokens     int           `json:"total_tokens"`
+	DistinctWords   int           `json:"distinct_words"`
+	KnownTokens     int           `json:"known_tokens"`
+	Comprehension   float64       `json:"comprehension"`
+	UnseenWords     int           `json:"unseen_words"`
+	TopUnknownWords []UnknownWord `json:"top_unknown_words"`
+	TargetLanguage  string        `json:"target_language"`
+}
+
+type MediaWord struct {
+	Word          string `json:"word"`
+	Amount        int    `json:"amount"`
+	FirstExposure bool   `json:"first_exposure"`
+}
+
+type MediaStats struct {
+	ID             string  `json:"id"`
+	UniqueWords    int     `json:"unique_words"`
+	NewWords       int     `json:"new_words"`
+	TotalTokens    int     `json:"total_tokens"`
+	CountedTokens  int     `json:"counted_tokens"`
+	LexicalDensity float64 `json:"lexical_density"`
+	SpeechRate     float64 `json:"speech_rate"`
+	Time           string  `json:"time"`
+}
+
+type UnknownWord struct {
+	Word   string `json:"word"`
+	Amount int    `json:"amount"`
+}
+
 type UpdateV struct {
 	IdUser string
 	IdMedia string
@@ -79,8 +124,8 @@ func ExtractYouTubeVideoID(url string) (string, error) {
 	return match[1], nil
 }
 
-func (t MediasModel) Insert(userId string, url string, kind string, watchType string, targetLanguage string) (string, string, error) {
-	query := `INSERT INTO medias(id_user, video_id, type, watch_type, target_language, title, time) VALUES($1,$2,$3,$4,$5,$6,$7) RETURNING id`
+func (t MediasModel) Insert(userId string, url string, kind string, watchType string, targetLanguage string, activityAt *time.Time) (string, string, error) {
+	query := `INSERT INTO medias(id_user, video_id, type, watch_type, target_language, title, time, status, activity_at) VALUES($1,$2,$3,$4,$5,$6,$7,$8,COALESCE($9, CURRENT_TIMESTAMP)) RETURNING id`
 	ctx := context.Background()
 
 	tx, err := t.DB.Begin(ctx)
@@ -93,7 +138,7 @@ func (t MediasModel) Insert(userId string, url string, kind string, watchType st
 		return "", "", err
 	}
 
-	args := []any{userId, videoId, kind, watchType, targetLanguage, "Processing Video Information – Please Wait", "00:00:00"}
+	args := []any{userId, videoId, kind, watchType, targetLanguage, "Processing Video Information – Please Wait", "00:00:00", MediaProcessing, activityAt}
 	var idMedia string
 
 	t.RDB.Del(ctx, `medias:user:`+userId)
@@ -114,10 +159,10 @@ func (t MediasModel) Insert(userId string, url string, kind string, watchType st
 func (t MediasModel) Get(userId string) (Medias, error) {
 	query := `
 		SELECT 
-			id, title, video_id, episode, type, watch_type, time::interval, created_at, target_language, 
+			id, title, video_id, episode, type, watch_type, time::interval, created_at, activity_at, target_language, 
 			SUM(time) OVER (PARTITION BY id_user) as total_time, 
 			SUM(total_words) OVER (PARTITION BY id_user) as sum_words,
-			total_words
+			total_words, status, task_error
 		FROM medias 
 		WHERE id_user = $1`
 
@@ -150,7 +195,7 @@ func (t MediasModel) Get(userId string) (Medias, error) {
 	for rows.Next() {
 		var r Video
 		var t time.Duration
-		err := rows.Scan(&r.ID, &r.Title, &r.VideoID, &r.Episode, &r.Type, &r.WatchType, &t, &r.CreatedAt, &r.TargetLanguage, &totalDuration, &totalWords, &r.TotalWords)
+		err := rows.Scan(&r.ID, &r.Title, &r.VideoID, &r.Episode, &r.Type, &r.WatchType, &t, &r.CreatedAt, &r.Date, &r.TargetLanguage, &totalDuration, &totalWords, &r.TotalWords, &r.Status, &r.TaskError)
 		if err != nil {
 			return Medias{}, err
 		}
@@ -185,6 +230,218 @@ func (t MediasModel) Get(userId string) (Medias, error) {
 	return medias, nil
 }
 
+// Preview compares the words of a transcript with the words the user has already
+// seen in the target language, without storing anything.
+func (t MediasModel) Preview(userId string, targetLanguage string, words map[string]int, totalTokens int, top int) (*MediaPreview, error) {
+	query := `
+		SELECT w.word
+		FROM aux_words_amount awa
+		INNER JOIN words w ON awa.word = w.id
+		WHERE awa.id_user = $1
+		  AND awa.language = $2
+		  AND w.word = ANY($3)`
+
+	ctx := context.Background()
+
+	list := make([]string, 0, len(words))
+	for word := range words {
+		list = append(list, word)
+	}
+
+	rows, err := t.DB.Query(ctx, query, userId, targetLanguage, list)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seen := make(map[string]bool)
+	for rows.Next() {
+		var word string
+		err := rows.Scan(&word)
+		if err != nil {
+			return nil, err
+		}
+		seen[word] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	preview := MediaPreview{
+		TotalTokens:     totalTokens,
+		DistinctWords:   len(words),
+		TargetLanguage:  targetLanguage,
+		TopUnknownWords: []UnknownWord{},
+	}
+
+	var unknown []UnknownWord
+	for word, amount := range words {
+		if seen[word] {
+			preview.KnownTokens += amount
+			continue
+		}
+		unknown = append(unknown, UnknownWord{Word: word, Amount: amount})
+	}
+
+	sort.Slice(unknown, func(i, j int) bool {
+		if unknown[i].Amount == unknown[j].Amount {
+			return unknown[i].Word < unknown[j].Word
+		}
+		return unknown[i].Amount > unknown[j].Amount
+	})
+
+	preview.UnseenWords = len(unknown)
+	if len(unknown) > top {
+		unknown = unknown[:top]
+	}
+	if len(unknown) > 0 {
+		preview.TopUnknownWords = unknown
+	}
+
+	if totalTokens > 0 {
+		preview.Comprehension = math.Round(float64(preview.KnownTokens)/float64(totalTokens)*10000) / 100
+	}
+
+	return &preview, nil
+}
+
+// GetWords lists the words a media contributed to the user, flagging the
+// ones that were seen for the first time when the media was processed.
+func (t MediasModel) GetWords(userId string, mediaId string, onlyNew bool) ([]MediaWord, error) {
+	query := `
+		SELECT w.word, mw.amount, mw.first_exposure
+		FROM media_words mw
+		INNER JOIN words w ON mw.word = w.id
+		WHERE mw.id_user = $1
+		  AND mw.id_media = $2
+		  AND (NOT $3 OR mw.first_exposure)
+		ORDER BY mw.amount DESC, w.word ASC`
+
+	ctx := context.Background()
+
+	var exists bool
+	err := t.DB.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM medias WHERE id_user = $1 AND id = $2)`, userId, mediaId).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, ErrMediaNotFound
+	}
+
+	rows, err := t.DB.Query(ctx, query, userId, mediaId, onlyNew)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	words := []MediaWord{}
+	for rows.Next() {
+		var w MediaWord
+		err := rows.Scan(&w.Word, &w.Amount, &w.FirstExposure)
+		if err != nil {
+			return nil, err
+		}
+		words = append(words, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return words, nil
+}
+
+// Stats summarizes the vocabulary of a processed media. Lexical density is the
+// ratio between unique and counted words, speech rate is in words per minute.
+func (t MediasModel) Stats(userId string, mediaId string) (*MediaStats, error) {
+	query := `
+		SELECT
+			m.id,
+			COALESCE(m.total_words, 0),
+			COALESCE(m.time, '00:00:00')::interval,
+			COUNT(mw.id),
+			COUNT(mw.id) FILTER (WHERE mw.first_exposure),
+			COALESCE(SUM(mw.amount), 0)
+		FROM medias m
+		LEFT JOIN media_words mw ON mw.id_media = m.id
+		WHERE m.id_user = $1 AND m.id = $2
+		GROUP BY m.id`
+
+	var stats MediaStats
+	var duration time.Duration
+
+	err := t.DB.QueryRow(context.Background(), query, userId, mediaId).Scan(&stats.ID, &stats.TotalTokens, &duration, &stats.UniqueWords, &stats.NewWords, &stats.CountedTokens)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrMediaNotFound
+		}
+		return nil, err
+	}
+
+	stats.Time = ParseTime(duration)
+
+	if stats.CountedTokens > 0 {
+		stats.LexicalDensity = math.Round(float64(stats.UniqueWords)/float64(stats.CountedTokens)*10000) / 10000
+	}
+
+	if duration.Minutes() > 0 {
+		stats.SpeechRate = math.Round(float64(stats.TotalTokens)/duration.Minutes()*100) / 100
+	}
+
+	return &stats, nil
+}
+
+// Update changes the fields that are not nil, the transcript is not processed again.
+func (t MediasModel) Update(user *User, id string, title, episode, kind, watchType *string, minutes *int) error {
+	query := `
+		UPDATE medias SET
+			title = COALESCE($3, title),
+			episode = COALESCE($4, episode),
+			type = COALESCE($5, type),
+			watch_type = COALESCE($6, watch_type),
+			time = COALESCE($7::time, time)
+		WHERE id_user = $1 AND id = $2`
+
+	ctx := context.Background()
+
+	var interval *string
+	if minutes != nil {
+		parsed := ParseMinutes(int32(*minutes))
+		interval = &parsed
+	}
+
+	args := []any{user.Id.String(), id, title, episode, kind, watchType, interval}
+
+	result, err := t.DB.Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrMediaNotFound
+	}
+
+	t.RDB.Del(ctx, "medias:user:"+user.Id.String())
+
+	return nil
+}
+
+// MarkProcessing flags a media whose transcript task was sent back to the queue.
+func (t MediasModel) MarkProcessing(userId string, mediaId string) error {
+	query := `UPDATE medias SET status = $3, task_error = NULL WHERE id_user = $1 AND id = $2`
+
+	ctx := context.Background()
+
+	_, err := t.DB.Exec(ctx, query, userId, mediaId, MediaProcessing)
+	if err != nil {
+		return err
+	}
+
+	t.RDB.Del(ctx, "medias:user:"+userId)
+
+	return nil
+}
+
 func (t MediasModel) Delete(user *User, id string) (string, string, error) {
 	query := "DELETE FROM medias WHERE id_user = $1 AND id = $2 RETURNING video_id, target_language"
 
@@ -12,6 +12,10 @@ type Models struct {
 	Anki AnkiModel
 	Vocabulary VocabularyModel
 	Book BookModel
+	Words WordModel
+	Frequency FrequencyModel
+	Reviews ReviewModel
+	Journal JournalModel
 }
 
 func NewModel(db *pgxpool.Pool, rdb *redis.Client) Models {
@@ -22,5 +26,9 @@ func NewModel(db *pgxpool.Pool, rdb *redis.Client) Models {
 		Anki: AnkiModel{db, rdb},
 		Vocabulary: VocabularyModel{db, rdb},
 		Book: BookModel{db, rdb},
+		Words: WordModel{db, rdb},
+		Frequency: FrequencyModel{db, rdb},
+		Reviews: ReviewModel{db, rdb},
+		Journal: JournalModel{db, rdb},
 	}
 }
@@ -0,0 +1,265 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrReviewWordNotFound = errors.New("the word was not found in the words of this language")
+	ErrInvalidGrade       = errors.New("the grade must be between 0 and 5")
+)
+
+type ReviewModel struct {
+	DB  *pgxpool.Pool
+	RDB *redis.Client
+}
+
+// ReviewCard is a word with its SM-2 scheduling state. New cards were never
+// reviewed and have no due date yet.
+type ReviewCard struct {
+	Word        string     `json:"word"`
+	Language    string     `json:"language"`
+	Amount      int        `json:"amount"`
+	Status      string     `json:"status"`
+	New         bool       `json:"new"`
+	Ease        float64    `json:"ease"`
+	Interval    int        `json:"interval"`
+	Repetitions int        `json:"repetitions"`
+	Lapses      int        `json:"lapses"`
+	DueAt       *time.Time `json:"due_at"`
+}
+
+type ReviewQueue struct {
+	Due []ReviewCard `json:"due"`
+	New []ReviewCard `json:"new"`
+}
+
+// Due returns the cards to review now, oldest first, and the words that can
+// still be introduced today given the daily limit of new cards. Learning words
+// come first, then the new words the immersion surfaced most.
+func (m ReviewModel) Due(user *User, language string, limit int, newPerDay int) (*ReviewQueue, error) {
+	queryDue := `
+		SELECT w.word, awa.language, awa.amount, awa.status, r.ease, r.interval_days, r.repetitions, r.lapses, r.due_at
+		FROM word_reviews r
+		INNER JOIN aux_words_amount awa ON awa.id = r.id_word_amount
+		INNER JOIN words w ON w.id = awa.word
+		WHERE r.id_user = $1 AND ($2 = '' OR awa.language = $2) AND r.due_at <= CURRENT_TIMESTAMP AND awa.status <> 'ignored'
+		ORDER BY r.due_at
+		LIMIT $3`
+	queryIntroduced := `
+		SELECT COUNT(*)
+		FROM word_reviews r
+		INNER JOIN aux_words_amount awa ON awa.id = r.id_word_amount
+		WHERE r.id_user = $1 AND ($2 = '' OR awa.language = $2) AND r.created_at >= DATE_TRUNC('day', CURRENT_TIMESTAMP)`
+	queryNew := `
+		SELECT w.word, awa.language, awa.amount, awa.status
+		FROM aux_words_amount awa
+		INNER JOIN words w ON w.id = awa.word
+		LEFT JOIN word_reviews r ON r.id_word_amount = awa.id
+		WHERE awa.id_user = $1 AND ($2 = '' OR awa.language = $2) AND awa.status IN ('learning', 'new') AND r.id_word_amount IS NULL
+		ORDER BY awa.status = 'learning' DESC, awa.amount DESC, awa.id
+		LIMIT $3`
+
+	ctx := context.Background()
+
+	queue := ReviewQueue{Due: []ReviewCard{}, New: []ReviewCard{}}
+
+	rows, err := m.DB.Query(ctx, queryDue, user.Id.String(), language, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c ReviewCard
+		err := rows.Scan(&c.Word, &c.Language, &c.Amount, &c.Status, &c.Ease, &c.Interval, &c.Repetitions, &c.Lapses, &c.DueAt)
+		if err != nil {
+			return nil, err
+		}
+		queue.Due = append(queue.Due, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var introduced int
+	err = m.DB.QueryRow(ctx, queryIntroduced, user.Id.String(), language).Scan(&introduced)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := newPerDay - introduced
+	if remaining <= 0 {
+		return &queue, nil
+	}
+
+	rows, err = m.DB.Query(ctx, queryNew, user.Id.String(), language, remaining)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c := ReviewCard{New: true, Ease: 2.5}
+		err := rows.Scan(&c.Word, &c.Language, &c.Amount, &c.Status)
+		if err != nil {
+			return nil, err
+		}
+		queue.New = append(queue.New, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &queue, nil
+}
+
+// Review grades a card from 0 (forgotten) to 5 (perfect recall), schedules its
+// next review and adds it, with the seconds spent, to the review session of
+// the day in the anki activity. A reviewed new word becomes learning.
+func (m ReviewModel) Review(user *User, language string, word string, grade int, seconds int) (*ReviewCard, error) {
+	queryCard := `
+		SELECT awa.id, w.word, awa.language, awa.amount, awa.status,
+			r.ease, r.interval_days, r.repetitions, r.lapses, r.due_at
+		FROM aux_words_amount awa
+		INNER JOIN words w ON w.id = awa.word
+		LEFT JOIN word_reviews r ON r.id_word_amount = awa.id
+		WHERE awa.id_user = $1 AND awa.language = $2 AND w.word = $3
+		FOR UPDATE OF awa`
+	upsertReview := `
+		INSERT INTO word_reviews(id_word_amount, id_user, ease, interval_days, repetitions, lapses, due_at, last_reviewed_at)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (id_word_amount) DO UPDATE SET
+			ease = EXCLUDED.ease,
+			interval_days = EXCLUDED.interval_days,
+			repetitions = EXCLUDED.repetitions,
+			lapses = EXCLUDED.lapses,
+			due_at = EXCLUDED.due_at,
+			last_reviewed_at = EXCLUDED.last_reviewed_at`
+	updateStatus := `
+		UPDATE aux_words_amount SET status = 'learning', status_updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = 'new'
+		RETURNING status`
+	updateSession := `
+		UPDATE anki SET
+			reviewed = COALESCE(reviewed, 0) + 1,
+			added_cards = COALESCE(added_cards, 0) + $3,
+			time = COALESCE(time, '00:00:00') + make_interval(secs => $4)
+		WHERE id = (
+			SELECT id FROM anki
+			WHERE id_user = $1 AND target_language = $2 AND source = 'reviews' AND activity_at >= DATE_TRUNC('day', CURRENT_TIMESTAMP)
+			ORDER BY id
+			LIMIT 1
+		)`
+	insertSession := `
+		INSERT INTO anki(id_user, reviewed, added_cards, time, target_language, source)
+		VALUES($1, 1, $3, '00:00:00'::time + make_interval(secs => $4), $2, 'reviews')`
+
+	if grade < 0 || grade > 5 {
+		return nil, ErrInvalidGrade
+	}
+
+	ctx := context.Background()
+
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	var id int64
+	var ease *float64
+	var interval, repetitions, lapses *int
+	c := ReviewCard{}
+
+	err = tx.QueryRow(ctx, queryCard, user.Id.String(), language, word).Scan(&id, &c.Word, &c.Language, &c.Amount, &c.Status, &ease, &interval, &repetitions, &lapses, &c.DueAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrReviewWordNotFound
+		}
+		return nil, err
+	}
+
+	isNew := ease == nil
+	c.Ease = 2.5
+	if !isNew {
+		c.Ease, c.Interval, c.Repetitions, c.Lapses = *ease, *interval, *repetitions, *lapses
+	}
+
+	now := time.Now()
+	scheduleReview(&c, grade, now)
+
+	_, err = tx.Exec(ctx, upsertReview, id, user.Id.String(), c.Ease, c.Interval, c.Repetitions, c.Lapses, c.DueAt, now)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRow(ctx, updateStatus, id).Scan(&c.Status)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	added := 0
+	if isNew {
+		added = 1
+	}
+
+	result, err := tx.Exec(ctx, updateSession, user.Id.String(), c.Language, added, float64(seconds))
+	if err != nil {
+		return nil, err
+	}
+
+	if result.RowsAffected() == 0 {
+		_, err = tx.Exec(ctx, insertSession, user.Id.String(), c.Language, added, float64(seconds))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	m.RDB.Del(ctx, "anki:user:"+user.Id.String())
+
+	return &c, nil
+}
+
+// scheduleReview applies the SM-2 algorithm: a grade under 3 restarts the
+// card, otherwise the interval grows by the ease, which follows the grades.
+func scheduleReview(c *ReviewCard, grade int, now time.Time) {
+	if grade < 3 {
+		c.Repetitions = 0
+		c.Interval = 1
+		c.Lapses++
+	} else {
+		switch c.Repetitions {
+		case 0:
+			c.Interval = 1
+		case 1:
+			c.Interval = 6
+		default:
+			c.Interval = int(math.Round(float64(c.Interval) * c.Ease))
+		}
+		c.Repetitions++
+	}
+
+	miss := float64(5 - grade)
+	c.Ease += 0.1 - miss*(0.08+miss*0.02)
+	if c.Ease < 1.3 {
+		c.Ease = 1.3
+	}
+
+	due := now.AddDate(0, 0, c.Interval)
+	c.DueAt = &due
+	c.New = false
+}
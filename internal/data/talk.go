@@ -3,14 +3,20 @@ package data
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"strings"
+	"language-tracker/internal/streaks"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
 )
 
+var (
+	ErrTalkNotFound = errors.New("the specified talk could not be found")
+)
+
 type TalkModel struct {
 	DB  *pgxpool.Pool
 	RDB *redis.Client
@@ -25,14 +31,43 @@ type DataOutput struct {
 }
 
 type Output struct {
-	ID             string    `json:"id"`
-	IDUser         string    `json:"-"`
-	Kind           string    `json:"type"`
-	Time           string    `json:"time"`
-	Summarize      string    `json:"summarize"`
-	TargetLanguage string    `json:"target_language"`
-	CreatedAt      time.Time `json:"created_at"`
-	Source         string    `json:"source"`
+	ID             string       `json:"id"`
+	IDUser         string       `json:"-"`
+	Kind           string       `json:"type"`
+	Time           string       `json:"time"`
+	Summarize      string       `json:"summarize"`
+	Partner        *string      `json:"partner"`
+	Topic          *string      `json:"topic"`
+	TargetLanguage string       `json:"target_language"`
+	CreatedAt      time.Time    `json:"created_at"`
+	Date           time.Time    `json:"date"`
+	Source         string       `json:"source"`
+	Audio          *OutputAudio `json:"audio"`
+}
+
+// OutputAudio is the recording attached to a session. The key locates the
+// file in the blob store and is not shown to the user.
+type OutputAudio struct {
+	Key         string  `json:"-"`
+	ContentType string  `json:"content_type"`
+	Size        int64   `json:"size"`
+	Seconds     float64 `json:"seconds"`
+}
+
+// OutputNotes describe a speaking or writing session: what was said or
+// written, with whom and about what.
+type OutputNotes struct {
+	Summarize string
+	Partner   string
+	Topic     string
+}
+
+// OutputSearchResult is a session matching a search, with the part of its
+// notes that matched.
+type OutputSearchResult struct {
+	Output
+	Headline string  `json:"headline"`
+	Rank     float64 `json:"rank"`
 }
 
 type OutputStreak struct {
@@ -56,8 +91,8 @@ func FormatMinutesToDuration(t string) string {
 	return ""
 }
 
-func (t TalkModel) Insert(id string, kind string, minutes int16, targetLanguage string) error {
-	query := `INSERT INTO output(id_user, type, time, target_language) VALUES($1,$2,$3,$4)`
+func (t TalkModel) Insert(id string, kind string, minutes int16, targetLanguage string, notes OutputNotes, audio *OutputAudio, activityAt *time.Time) error {
+	query := `INSERT INTO output(id_user, type, time, target_language, activity_at, summarize, partner, topic, audio_key, audio_content_type, audio_size, audio_seconds) VALUES($1,$2,$3,$4,COALESCE($5, CURRENT_TIMESTAMP),NULLIF($6, ''),NULLIF($7, ''),NULLIF($8, ''),$9,$10,$11,$12)`
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -71,7 +106,10 @@ func (t TalkModel) Insert(id string, kind string, minutes int16, targetLanguage
 	var min time.Time
 	min = min.Add(time.Duration(minutes) * time.Minute)
 
-	args := []any{id, kind, min.Format("15:04:05"), targetLanguage}
+	args := []any{id, kind, min.Format("15:04:05"), targetLanguage, activityAt, notes.Summarize, notes.Partner, notes.Topic, nil, nil, nil, nil}
+	if audio != nil {
+		args[8], args[9], args[10], args[11] = audio.Key, audio.ContentType, audio.Size, audio.Seconds
+	}
 
 	err = t.RDB.Del(ctx, `talk:user:`+id).Err()
 
@@ -92,8 +130,10 @@ func (t TalkModel) Insert(id string, kind string, minutes int16, targetLanguage
 	return nil
 }
 
-func (t TalkModel) GetByUser(id string) (DataOutput, error) {
-	query := `SELECT id, type, time::interval, target_language, created_at, AVG(time::interval) OVER (PARTITION BY time) as avg_time, SUM(time::interval) OVER (PARTITION BY time) AS sum_time FROM output WHERE id_user = $1 ORDER BY created_at ASC
+func (t TalkModel) GetByUser(user *User) (DataOutput, error) {
+	id := user.Id.String()
+
+	query := `SELECT id, type, time::interval, COALESCE(summarize, ''), partner, topic, target_language, created_at, activity_at, audio_key, audio_content_type, audio_size, audio_seconds, AVG(time::interval) OVER (PARTITION BY time) as avg_time, SUM(time::interval) OVER (PARTITION BY time) AS sum_time FROM output WHERE id_user = $1 ORDER BY activity_at ASC
 	`
 	// ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	// defer cancel()
@@ -109,6 +149,7 @@ func (t TalkModel) GetByUser(id string) (DataOutput, error) {
 		if err != nil {
 			return DataOutput{}, err
 		}
+		output.OutputStreak = outputStreak(user, output.Output)
 		return output, nil
 	}
 
@@ -131,10 +172,16 @@ func (t TalkModel) GetByUser(id string) (DataOutput, error) {
 	for rows.Next() {
 		var r Output
 		var t time.Duration
-		err := rows.Scan(&r.ID, &r.Kind, &t, &r.TargetLanguage, &r.CreatedAt, &avgTime, &totalTime)
+		var audioKey, audioContentType *string
+		var audioSize *int64
+		var audioSeconds *float64
+		err := rows.Scan(&r.ID, &r.Kind, &t, &r.Summarize, &r.Partner, &r.Topic, &r.TargetLanguage, &r.CreatedAt, &r.Date, &audioKey, &audioContentType, &audioSize, &audioSeconds, &avgTime, &totalTime)
 		if err != nil {
 			return DataOutput{}, err
 		}
+		if audioKey != nil {
+			r.Audio = &OutputAudio{Key: *audioKey, ContentType: *audioContentType, Size: *audioSize, Seconds: *audioSeconds}
+		}
 		r.Source = "Talk"
 		r.Time = ParseTime(t)
 		talk = append(talk, r)
@@ -156,42 +203,96 @@ func (t TalkModel) GetByUser(id string) (DataOutput, error) {
 		output.Output = make([]Output, 1)
 	}
 
-	var count = 1
-	var bigStreak = 1
-	for i := 1; i < len(talk); i++ {
-		splited := strings.Split(talk[i].CreatedAt.String(), " ")[0]
-		splitb := strings.Split(talk[i-1].CreatedAt.String(), " ")[0]
+	bytes, err := json.Marshal(output)
+	if err != nil {
+		return DataOutput{}, err
+	}
 
-		splitedP1, _ := time.Parse("2006-01-02", splited)
-		splitbP1, _ := time.Parse("2006-01-02", splitb)
+	err = t.RDB.Set(context.Background(), `talk:user:`+id, bytes, 0).Err()
+	if err != nil {
+		return DataOutput{}, err
+	}
 
-		if splitedP1.Sub(splitbP1) == 24*time.Hour {
-			count++
-		} else {
-			if splitb != splited {
-				count = 1
-			}
-		}
+	output.OutputStreak = outputStreak(user, output.Output)
+
+	return output, nil
+}
+
+// outputStreak is computed on every read, the current streak depends on the
+// day and on the timezone of the user.
+func outputStreak(user *User, talk []Output) OutputStreak {
+	loc := user.Configs.Location()
 
-		if count > bigStreak {
-			bigStreak = count
+	dates := make([]time.Time, 0, len(talk))
+	for _, o := range talk {
+		if !o.Date.IsZero() {
+			dates = append(dates, o.Date.In(loc))
 		}
 	}
 
-	output.OutputStreak.CurrentStreak = int64(count)
-	output.OutputStreak.LongestStreak = int64(bigStreak)
+	streak := streaks.Compute(dates, streaks.Options{
+		Today:           time.Now().In(loc),
+		FreezesPerMonth: int(user.Configs.StreakFreezes),
+	})
 
-	bytes, err := json.Marshal(output)
+	return OutputStreak{LongestStreak: int64(streak.Longest), CurrentStreak: int64(streak.Current)}
+}
+
+func (t TalkModel) Update(user *User, id string, kind *string, minutes *int, targetLanguage *string, summarize *string, partner *string, topic *string) error {
+	query := `
+		UPDATE output SET
+			type = COALESCE($3, type),
+			time = COALESCE($4::time, time),
+			target_language = COALESCE($5, target_language),
+			summarize = COALESCE($6, summarize),
+			partner = COALESCE($7, partner),
+			topic = COALESCE($8, topic)
+		WHERE id_user = $1 AND id = $2`
+
+	ctx := context.Background()
+
+	var interval *string
+	if minutes != nil {
+		parsed := ParseMinutes(int32(*minutes))
+		interval = &parsed
+	}
+
+	args := []any{user.Id.String(), id, kind, interval, targetLanguage, summarize, partner, topic}
+
+	result, err := t.DB.Exec(ctx, query, args...)
 	if err != nil {
-		return DataOutput{}, err
+		return err
 	}
 
-	err = t.RDB.Set(context.Background(), `talk:user:`+id, bytes, 0).Err()
+	if result.RowsAffected() == 0 {
+		return ErrTalkNotFound
+	}
+
+	t.RDB.Del(ctx, "talk:user:"+user.Id.String())
+
+	return nil
+}
+
+// Audio returns the recording of a session, nil when the session has none.
+func (t TalkModel) Audio(user *User, id string) (*OutputAudio, error) {
+	query := `SELECT audio_key, COALESCE(audio_content_type, ''), COALESCE(audio_size, 0), COALESCE(audio_seconds, 0) FROM output WHERE id_user = $1 AND id = $2`
+
+	var key *string
+	var audio OutputAudio
+	err := t.DB.QueryRow(context.Background(), query, user.Id.String(), id).Scan(&key, &audio.ContentType, &audio.Size, &audio.Seconds)
 	if err != nil {
-		return DataOutput{}, err
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrTalkNotFound
+		}
+		return nil, err
 	}
 
-	return output, nil
+	if key == nil {
+		return nil, nil
+	}
+	audio.Key = *key
+
+	return &audio, nil
 }
 
 func (t TalkModel) Delete(user *User, id string) error {
@@ -218,3 +319,43 @@ func (t TalkModel) Delete(user *User, id string) error {
 
 	return nil
 }
+
+// Search finds the sessions of the user whose topic, partner, notes or type
+// match the query, written like a web search. The best matches come first.
+func (t TalkModel) Search(user *User, q string, language string, limit int) ([]OutputSearchResult, error) {
+	query := `
+		SELECT o.id, o.type, o.time::interval, COALESCE(o.summarize, ''), o.partner, o.topic, o.target_language, o.created_at, o.activity_at,
+			ts_rank(o.search, query) AS rank,
+			ts_headline('simple', COALESCE(o.summarize, o.topic, o.type), query, 'MaxFragments=2, MaxWords=20, MinWords=5')
+		FROM output o, websearch_to_tsquery('simple', $2) query
+		WHERE o.id_user = $1 AND o.search @@ query AND ($3 = '' OR o.target_language = $3)
+		ORDER BY rank DESC, o.activity_at DESC
+		LIMIT $4`
+
+	ctx := context.Background()
+
+	rows, err := t.DB.Query(ctx, query, user.Id.String(), q, language, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []OutputSearchResult{}
+	for rows.Next() {
+		var r OutputSearchResult
+		var d time.Duration
+		err := rows.Scan(&r.ID, &r.Kind, &d, &r.Summarize, &r.Partner, &r.Topic, &r.TargetLanguage, &r.CreatedAt, &r.Date, &r.Rank, &r.Headline)
+		if err != nil {
+			return nil, err
+		}
+
+		r.Source = "Talk"
+		r.Time = ParseTime(d)
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
@@ -2,10 +2,9 @@ package data
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
 	"errors"
-	"fmt"
+	"language-tracker/internal/streaks"
 	"time"
 
 	"github.com/google/uuid"
@@ -25,6 +24,24 @@ type UserConfig struct {
 	ReadWordsPerMinute  int32  `json:"wpm"`
 	AverageWordsPerPage int32  `json:"averageWordsPage"`
 	DailyGoal           int32  `json:"dailyGoal"`
+	LearningThreshold   int32  `json:"learningThreshold"`
+	KnownThreshold      int32  `json:"knownThreshold"`
+	Timezone            string `json:"timezone"`
+	StreakFreezes       int32  `json:"streakFreezes"`
+}
+
+// Location is the timezone of the user, UTC when unset or unknown.
+func (c UserConfig) Location() *time.Location {
+	if c.Timezone == "" {
+		return time.UTC
+	}
+
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+
+	return loc
 }
 
 type User struct {
@@ -35,24 +52,23 @@ type User struct {
 	Configs        UserConfig `json:"configs"`
 	Email_token    uuid.UUID  `json:"-"`
 	Email_verified bool       `json:"-"`
+	IsAdmin        bool       `json:"-"`
 	Created_at     time.Time  `json:"created_at"`
 	Updated_at     time.Time
 }
 
+// MonthReport is the time of all the activities of a month, Listening is the
+// part of it spent on audiobooks.
 type MonthReport struct {
-	Month time.Time `json:"month"`
-	Hours string    `json:"duration"`
+	Month     time.Time `json:"month"`
+	Hours     string    `json:"duration"`
+	Listening string    `json:"listening"`
 }
 
 type DailyReport struct {
-	Day     time.Time `json:"date"`
-	Minutes int       `json:"count"`
-}
-
-type WordsKnow struct {
-	Word     string `json:"word"`
-	Amount   string `json:"amount"`
-	Language string `json:"language"`
+	Day       time.Time `json:"date"`
+	Minutes   int       `json:"count"`
+	Listening int       `json:"listening"`
 }
 
 var (
@@ -60,7 +76,6 @@ var (
 	ErrDuplicateUsername = errors.New("this username is already taken, please choose another")
 	ErrUserNotFound      = errors.New("the specified user could not be found")
 	ErrEmailNotFound     = errors.New("the email could not be found")
-	WordsNotFound        = errors.New("words not found")
 )
 
 func (m UserModel) Insert(username string, email string, password string) (string, string, error) {
@@ -174,7 +189,7 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 }
 
 func (m UserModel) Get(id string) (*User, error) {
-	query := `SELECT id, username, password, configs, created_at FROM users WHERE id = $1`
+	query := `SELECT id, username, password, configs, is_admin, created_at FROM users WHERE id = $1`
 	tx, err := m.DB.Begin(context.Background())
 	if err != nil {
 		return nil, err
@@ -184,7 +199,7 @@ func (m UserModel) Get(id string) (*User, error) {
 
 	var user User
 
-	err = tx.QueryRow(context.Background(), query, args...).Scan(&user.Id, &user.Username, &user.Password, &user.Configs, &user.Created_at)
+	err = tx.QueryRow(context.Background(), query, args...).Scan(&user.Id, &user.Username, &user.Password, &user.Configs, &user.IsAdmin, &user.Created_at)
 	if err != nil {
 		return nil, ErrUserNotFound
 	}
@@ -224,6 +239,24 @@ func (m UserModel) Edit(newConfig UserConfig, id string) error {
 		user.Configs.ReadWordsPerMinute = newConfig.ReadWordsPerMinute
 	}
 
+	// a negative threshold turns the automatic promotion off
+	if newConfig.LearningThreshold != 0 {
+		user.Configs.LearningThreshold = max(newConfig.LearningThreshold, 0)
+	}
+
+	if newConfig.KnownThreshold != 0 {
+		user.Configs.KnownThreshold = max(newConfig.KnownThreshold, 0)
+	}
+
+	if newConfig.Timezone != "" {
+		user.Configs.Timezone = newConfig.Timezone
+	}
+
+	// a negative number of freezes turns them off
+	if newConfig.StreakFreezes != 0 {
+		user.Configs.StreakFreezes = max(newConfig.StreakFreezes, 0)
+	}
+
 	query = "UPDATE users SET configs = $1 WHERE id = $2"
 
 	args := []any{user.Configs, id}
@@ -238,19 +271,77 @@ func (m UserModel) Edit(newConfig UserConfig, id string) error {
 	return nil
 }
 
+// Streaks computes the streaks of the user on the calendar days of their
+// timezone, for each kind of activity and overall.
+func (m UserModel) Streaks(user *User) (*streaks.Summary, error) {
+	query := `
+	SELECT kind, (activity_at AT TIME ZONE $2)::date AS day
+	FROM (
+	    SELECT 'anki' AS kind, id_user, activity_at FROM anki
+	    UNION ALL
+	    SELECT 'media' AS kind, id_user, activity_at FROM medias
+	    UNION ALL
+	    SELECT 'talk' AS kind, id_user, activity_at FROM output
+	    UNION ALL
+	    SELECT CASE WHEN b.format = 'audiobook' THEN 'listening' ELSE 'books' END AS kind, bh.id_user, bh.activity_at
+	    FROM books_history bh
+	    LEFT JOIN books b ON b.id = bh.id_book
+	    UNION ALL
+	    SELECT 'journal' AS kind, id_user, activity_at FROM journal
+	) AS combined
+	WHERE id_user = $1
+	GROUP BY kind, day
+	`
+
+	loc := user.Configs.Location()
+
+	rows, err := m.DB.Query(context.Background(), query, user.Id.String(), loc.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	activities := map[string][]time.Time{}
+	for rows.Next() {
+		var kind string
+		var day time.Time
+		err := rows.Scan(&kind, &day)
+		if err != nil {
+			return nil, err
+		}
+		activities[kind] = append(activities[kind], day)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	summary := streaks.Summarize(activities, streaks.Options{
+		Today:           time.Now().In(loc),
+		FreezesPerMonth: int(user.Configs.StreakFreezes),
+	})
+
+	return &summary, nil
+}
+
 func (m UserModel) Report(user *User) (*[]MonthReport, *[]DailyReport, error) {
 	query := `
 	SELECT
-	    DATE_TRUNC('month', created_at) AS month,
-	    SUM(time::interval) AS total_time
+	    DATE_TRUNC('month', activity_at) AS month,
+	    SUM(time::interval) AS total_time,
+	    COALESCE(SUM(time::interval) FILTER (WHERE listening), '0s'::interval) AS listening_time
 	FROM (
-	    SELECT id_user, time::interval, created_at FROM anki
+	    SELECT id_user, time::interval, activity_at, false AS listening FROM anki
 	    UNION ALL
-	    SELECT id_user, time::interval, created_at FROM medias
+	    SELECT id_user, time::interval, activity_at, false AS listening FROM medias
 	    UNION ALL
-	    SELECT id_user, time::interval, created_at FROM output
+	    SELECT id_user, time::interval, activity_at, false AS listening FROM output
 	    UNION ALL
-	    SELECT id_user, COALESCE(time_diff, '0:00:00'::time)::interval AS time, created_at FROM books_history
+	    SELECT bh.id_user, COALESCE(bh.time_diff, '0:00:00'::time)::interval AS time, bh.activity_at, b.format = 'audiobook' AS listening
+	    FROM books_history bh
+	    LEFT JOIN books b ON b.id = bh.id_book
+	    UNION ALL
+	    SELECT id_user, time::interval, activity_at, false AS listening FROM journal
 	) AS combined
 	WHERE id_user = $1
 	GROUP BY month
@@ -258,16 +349,21 @@ func (m UserModel) Report(user *User) (*[]MonthReport, *[]DailyReport, error) {
 	`
 	queryDaily := `
 	SELECT 
-	    DATE_TRUNC('day', created_at) AS day,
-	    SUM(EXTRACT(EPOCH FROM time::interval) / 60)::integer AS total_minutes
+	    DATE_TRUNC('day', activity_at) AS day,
+	    SUM(EXTRACT(EPOCH FROM time::interval) / 60)::integer AS total_minutes,
+	    COALESCE(SUM(EXTRACT(EPOCH FROM time::interval) / 60) FILTER (WHERE listening), 0)::integer AS listening_minutes
 	FROM (
-	    SELECT id_user, time::interval, created_at FROM anki
+	    SELECT id_user, time::interval, activity_at, false AS listening FROM anki
+	    UNION ALL
+	    SELECT id_user, time::interval, activity_at, false AS listening FROM medias
 	    UNION ALL
-	    SELECT id_user, time::interval, created_at FROM medias
+	    SELECT id_user, time::interval, activity_at, false AS listening FROM output
 	    UNION ALL
-	    SELECT id_user, time::interval, created_at FROM output
+	    SELECT bh.id_user, COALESCE(bh.time_diff, '0:00:00'::time)::interval AS time, bh.activity_at, b.format = 'audiobook' AS listening
+	    FROM books_history bh
+	    LEFT JOIN books b ON b.id = bh.id_book
 	    UNION ALL
-	    SELECT id_user, COALESCE(time_diff, '0:00:00'::time)::interval AS time, created_at FROM books_history
+	    SELECT id_user, time::interval, activity_at, false AS listening FROM journal
 	) AS combined
 	WHERE id_user = $1
 	GROUP BY day
@@ -289,13 +385,14 @@ func (m UserModel) Report(user *User) (*[]MonthReport, *[]DailyReport, error) {
 	var report []MonthReport
 	for rows.Next() {
 		var t MonthReport
-		var d time.Duration
-		err := rows.Scan(&t.Month, &d)
+		var d, listening time.Duration
+		err := rows.Scan(&t.Month, &d, &listening)
 		if err != nil {
 			return nil, nil, err
 		}
 
 		t.Hours = ParseTime(d)
+		t.Listening = ParseTime(listening)
 		report = append(report, t)
 	}
 
@@ -307,7 +404,7 @@ func (m UserModel) Report(user *User) (*[]MonthReport, *[]DailyReport, error) {
 	var dailyReport []DailyReport
 	for rows.Next() {
 		var d DailyReport
-		err := rows.Scan(&d.Day, &d.Minutes)
+		err := rows.Scan(&d.Day, &d.Minutes, &d.Listening)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -323,6 +420,7 @@ func (m UserModel) Report(user *User) (*[]MonthReport, *[]DailyReport, error) {
 		m.Month = time.Now()
 		hours, _ := time.ParseDuration("0s")
 		m.Hours = ParseTime(hours)
+		m.Listening = ParseTime(hours)
 		dailyReport = append(dailyReport, d)
 		report = append(report, m)
 	}
@@ -334,61 +432,3 @@ func (m UserModel) Report(user *User) (*[]MonthReport, *[]DailyReport, error) {
 
 	return &report, &dailyReport, nil
 }
-
-func (m UserModel) GetWords(user *User, language, order string, limit, page, min, max int) (*[]WordsKnow, error) {
-	query := fmt.Sprintf(`
-	    SELECT w.word,
-		   awa.amount,
-		   awa.language
-	    FROM aux_words_amount awa
-	    INNER JOIN words w ON awa.word = w.id
-	    WHERE awa.id_user = $1
-	      AND awa.language = $2
-		AND awa.amount > $5 
-		AND awa.amount < $6
-	    ORDER BY awa.amount %s
-	    LIMIT $3
-	    OFFSET $4;
-	    `, order)
-
-	offset := (page - 1) * limit
-
-	if offset < 0 {
-		offset = 1
-	}
-
-	args := []any{user.Id.String(), language, limit, offset, min, max}
-
-	tx, err := m.DB.Begin(context.Background())
-	if err != nil {
-		return nil, err
-	}
-
-	defer tx.Rollback(context.Background())
-
-	rows, err := tx.Query(context.Background(), query, args...)
-
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, WordsNotFound
-		}
-	}
-
-	var wordsKnow []WordsKnow
-	for rows.Next() {
-		var w WordsKnow
-		err := rows.Scan(&w.Word, &w.Amount, &w.Language)
-		if err != nil {
-			return nil, err
-		}
-
-		wordsKnow = append(wordsKnow, w)
-	}
-
-	err = tx.Commit(context.Background())
-	if err != nil {
-		return nil, err
-	}
-
-	return &wordsKnow, nil
-}
@@ -3,12 +3,18 @@ package data
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
 )
 
+var (
+	ErrVocabularyNotFound = errors.New("the specified vocabulary could not be found")
+)
+
 type VocabularyModel struct {
 	DB  *pgxpool.Pool
 	RDB *redis.Client
@@ -25,13 +31,15 @@ type Vocabulary struct {
 	DifferenceLastMonth int64     `json:"difference_last_month"`
 	URL                 *string   `json:"url"`
 	TargetLanguage      string    `json:"target_language"`
-	Date                time.Time `json:"created_at"`
+	CreatedAt           time.Time `json:"created_at"`
+	Date                time.Time `json:"date"`
 	Kind                string    `json:"source"`
 }
 
-func (v VocabularyModel) Insert(user string, vocabulary int32, targetLanguage string) error {
-	query := "INSERT INTO vocabulary(id_user, vocabulary, target_language, diff_last) VALUES ($1, $2, $3, $4)"
-	lastDiff := "SELECT vocabulary FROM vocabulary WHERE id_user = $1 ORDER BY created_at ASC"
+// Insert adds an entry. An entry dated in the past changes the difference of
+// the entry after it, so the differences of the user are recomputed.
+func (v VocabularyModel) Insert(user string, vocabulary int32, targetLanguage string, activityAt *time.Time) error {
+	query := "INSERT INTO vocabulary(id_user, vocabulary, target_language, diff_last, activity_at) VALUES ($1, $2, $3, 0, COALESCE($4, CURRENT_TIMESTAMP))"
 
 	ctx := context.Background()
 
@@ -41,28 +49,31 @@ func (v VocabularyModel) Insert(user string, vocabulary int32, targetLanguage st
 	}
 
 	defer tx.Rollback(ctx)
-	var lastVocabulary int
 
-	err = tx.QueryRow(ctx, lastDiff, user).Scan(&lastVocabulary)
-
-	args := []any{user, vocabulary, targetLanguage, vocabulary - int32(lastVocabulary)}
+	args := []any{user, vocabulary, targetLanguage, activityAt}
 
 	_, err = tx.Exec(ctx, query, args...)
 	if err != nil {
 		return err
 	}
 
-	v.RDB.Del(ctx, "vocabulary:user:"+user)
+	err = recomputeVocabularyDiff(ctx, tx, user)
+	if err != nil {
+		return err
+	}
+
 	err = tx.Commit(ctx)
 	if err != nil {
 		return err
 	}
 
+	v.RDB.Del(ctx, "vocabulary:user:"+user)
+
 	return nil
 }
 
 func (v VocabularyModel) GetByUser(user string) (*DataVocabulary, error) {
-	query := "SELECT id, vocabulary, diff_last, target_language, created_at, AVG(diff_last) OVER (PARTITION BY diff_last) FROM vocabulary WHERE id_user = $1"
+	query := "SELECT id, vocabulary, diff_last, target_language, created_at, activity_at, AVG(diff_last) OVER (PARTITION BY diff_last) FROM vocabulary WHERE id_user = $1 ORDER BY activity_at ASC"
 
 	ctx := context.Background()
 
@@ -94,7 +105,7 @@ func (v VocabularyModel) GetByUser(user string) (*DataVocabulary, error) {
 	var vocabulary []Vocabulary
 	for rows.Next() {
 		var v Vocabulary
-		err := rows.Scan(&v.ID, &v.Vocabulary, &v.DifferenceLastMonth, &v.TargetLanguage, &v.Date, &DataVocabulary.Average)
+		err := rows.Scan(&v.ID, &v.Vocabulary, &v.DifferenceLastMonth, &v.TargetLanguage, &v.CreatedAt, &v.Date, &DataVocabulary.Average)
 		if err != nil {
 			return nil, err
 		}
@@ -126,27 +137,99 @@ func (v VocabularyModel) GetByUser(user string) (*DataVocabulary, error) {
 	return &DataVocabulary, nil
 }
 
+// Update changes an entry and recomputes the difference to the previous entry
+// of every entry of the user, since editing one also changes the next one.
+func (v VocabularyModel) Update(user *User, id string, vocabulary *int32, targetLanguage *string) error {
+	query := `
+		UPDATE vocabulary SET
+			vocabulary = COALESCE($3, vocabulary),
+			target_language = COALESCE($4, target_language),
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id_user = $1 AND id = $2`
+
+	ctx := context.Background()
+
+	tx, err := v.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	args := []any{user.Id.String(), id, vocabulary, targetLanguage}
+
+	result, err := tx.Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrVocabularyNotFound
+	}
+
+	err = recomputeVocabularyDiff(ctx, tx, user.Id.String())
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return err
+	}
+
+	v.RDB.Del(ctx, "vocabulary:user:"+user.Id.String())
+
+	return nil
+}
+
+// Delete removes an entry, the entry after it is now compared to the one
+// before it.
 func (v VocabularyModel) Delete(user *User, id string) error {
 	query := "DELETE FROM vocabulary WHERE id_user = $1 AND id = $2"
 
-	tx, err := v.DB.Begin(context.Background())
+	ctx := context.Background()
+
+	tx, err := v.DB.Begin(ctx)
 	if err != nil {
-		return nil
+		return err
 	}
 
-	v.RDB.Del(context.Background(), "vocabulary:user:"+user.Id.String())
+	defer tx.Rollback(ctx)
 
 	args := []any{user.Id.String(), id}
-	_, err = tx.Exec(context.Background(), query, args...)
+	_, err = tx.Exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
 
+	err = recomputeVocabularyDiff(ctx, tx, user.Id.String())
 	if err != nil {
 		return err
 	}
 
-	err = tx.Commit(context.Background())
+	err = tx.Commit(ctx)
 	if err != nil {
 		return err
 	}
 
+	v.RDB.Del(ctx, "vocabulary:user:"+user.Id.String())
+
 	return nil
 }
+
+// recomputeVocabularyDiff sets the difference of every entry of the user to
+// the previous entry of the same language, in date order.
+func recomputeVocabularyDiff(ctx context.Context, tx pgx.Tx, user string) error {
+	query := `
+		UPDATE vocabulary v
+		SET diff_last = v.vocabulary - COALESCE(previous.vocabulary, 0)
+		FROM (
+			SELECT id, LAG(vocabulary) OVER (PARTITION BY target_language ORDER BY activity_at, created_at, id) AS vocabulary
+			FROM vocabulary
+			WHERE id_user = $1
+		) AS previous
+		WHERE v.id = previous.id AND v.diff_last IS DISTINCT FROM v.vocabulary - COALESCE(previous.vocabulary, 0)`
+
+	_, err := tx.Exec(ctx, query, user)
+	return err
+}
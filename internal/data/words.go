@@ -0,0 +1,560 @@
+package data
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	WordNew      = "new"
+	WordLearning = "learning"
+	WordKnown    = "known"
+	WordIgnored  = "ignored"
+)
+
+var (
+	ErrInvalidWordStatus = errors.New("the status must be one of new, learning, known or ignored")
+	ErrInvalidWordSort   = errors.New("the sort must be one of amount, word, first_seen or last_seen")
+	ErrInvalidInterval   = errors.New("the interval must be one of day, week or month")
+	ErrInvalidWordOrder  = errors.New("only asc and desc are allowed")
+	ErrInvalidWordMatch  = errors.New("the match must be prefix or substring")
+	ErrInvalidCursor     = errors.New("the cursor is invalid")
+)
+
+// wordSorts maps the accepted sort values to the column used for ordering and
+// its type, nothing else from the request is written in the query. Words never
+// seen in a media have no dates and sort as the oldest.
+var wordSorts = map[string]struct{ column, kind string }{
+	"amount":     {"awa.amount", "bigint"},
+	"word":       {"w.word", "text"},
+	"first_seen": {"COALESCE(awa.first_seen_at, '-infinity')", "timestamptz"},
+	"last_seen":  {"COALESCE(awa.last_seen_at, '-infinity')", "timestamptz"},
+}
+
+var wordIntervals = map[string]bool{
+	"day":   true,
+	"week":  true,
+	"month": true,
+}
+
+// MaxExportWords caps the size of a single export.
+const MaxExportWords = 20000
+
+var wordOrders = map[string]string{
+	"asc":  "ASC",
+	"desc": "DESC",
+}
+
+type WordFilter struct {
+	Language string
+	Status   string
+	Search   string
+	Match    string
+	Sort     string
+	Order    string
+	Min      *int
+	Max      *int
+	Limit    int
+	Cursor   string
+}
+
+type WordList struct {
+	Words []WordStatus
+	Total int
+}
+
+// wordCursor is the last row of a page, the next page starts right after it.
+type wordCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int64  `json:"id"`
+}
+
+type WordModel struct {
+	DB  *pgxpool.Pool
+	RDB *redis.Client
+}
+
+type WordStatus struct {
+	Word            string     `json:"word"`
+	Language        string     `json:"language"`
+	Amount          int        `json:"amount"`
+	Status          string     `json:"status"`
+	StatusUpdatedAt *time.Time `json:"status_updated_at"`
+	FirstSeenAt     *time.Time `json:"first_seen_at"`
+	LastSeenAt      *time.Time `json:"last_seen_at"`
+}
+
+type WordGrowth struct {
+	Period time.Time `json:"period"`
+	New    int       `json:"new"`
+	Total  int       `json:"total"`
+}
+
+type WordExport struct {
+	Word     string
+	Language string
+	Amount   int
+	Status   string
+	Example  string
+}
+
+type WordExample struct {
+	Sentence string  `json:"sentence"`
+	Start    float64 `json:"start"`
+	MediaId  string  `json:"media_id"`
+	Title    string  `json:"title"`
+	VideoId  *string `json:"video_id"`
+	Link     *string `json:"link"`
+}
+
+type WordsTotal struct {
+	Language string `json:"language"`
+	Total    int    `json:"total"`
+	New      int    `json:"new"`
+	Learning int    `json:"learning"`
+	Known    int    `json:"known"`
+	Ignored  int    `json:"ignored"`
+}
+
+func ValidWordStatus(status string) bool {
+	switch status {
+	case WordNew, WordLearning, WordKnown, WordIgnored:
+		return true
+	}
+
+	return false
+}
+
+// SetStatus changes the status of words of a language. Words the user never
+// met are added with no exposure, so a word can be ignored or marked as known
+// before it shows up in a media.
+func (m WordModel) SetStatus(user *User, language string, status string, words []string) ([]WordStatus, error) {
+	insertWords := `
+		INSERT INTO words(word)
+		SELECT word FROM unnest($1::text[]) AS word
+		ORDER BY word
+		ON CONFLICT (word) DO NOTHING`
+	query := `
+		INSERT INTO aux_words_amount(id_user, word, amount, language, status, status_updated_at)
+		SELECT $1, w.id, 0, $2, $3, CURRENT_TIMESTAMP
+		FROM words w
+		WHERE w.word = ANY($4)
+		ORDER BY w.id
+		ON CONFLICT (id_user, language, word) DO UPDATE SET status = EXCLUDED.status, status_updated_at = EXCLUDED.status_updated_at
+		RETURNING (SELECT word FROM words WHERE id = aux_words_amount.word), amount, status, status_updated_at, first_seen_at, last_seen_at`
+
+	if !ValidWordStatus(status) {
+		return nil, ErrInvalidWordStatus
+	}
+
+	ctx := context.Background()
+
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, insertWords, words)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, query, user.Id.String(), language, status, words)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	updated := []WordStatus{}
+	for rows.Next() {
+		w := WordStatus{Language: language}
+		err := rows.Scan(&w.Word, &w.Amount, &w.Status, &w.StatusUpdatedAt, &w.FirstSeenAt, &w.LastSeenAt)
+		if err != nil {
+			return nil, err
+		}
+		updated = append(updated, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// Totals counts the words of the user in each status, per language.
+func (m WordModel) Totals(user *User) ([]WordsTotal, error) {
+	query := `
+		SELECT
+			language,
+			COUNT(*),
+			COUNT(*) FILTER (WHERE status = 'new'),
+			COUNT(*) FILTER (WHERE status = 'learning'),
+			COUNT(*) FILTER (WHERE status = 'known'),
+			COUNT(*) FILTER (WHERE status = 'ignored')
+		FROM aux_words_amount
+		WHERE id_user = $1
+		GROUP BY language
+		ORDER BY language`
+
+	rows, err := m.DB.Query(context.Background(), query, user.Id.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := []WordsTotal{}
+	for rows.Next() {
+		var t WordsTotal
+		err := rows.Scan(&t.Language, &t.Total, &t.New, &t.Learning, &t.Known, &t.Ignored)
+		if err != nil {
+			return nil, err
+		}
+		totals = append(totals, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return totals, nil
+}
+
+// List returns a page of the user words matching the filter, the total of
+// matching words and the cursor of the next page when there is one.
+func (m WordModel) List(user *User, filter WordFilter) (*WordList, string, error) {
+	sort, ok := wordSorts[filter.Sort]
+	if !ok {
+		return nil, "", ErrInvalidWordSort
+	}
+
+	order, ok := wordOrders[filter.Order]
+	if !ok {
+		return nil, "", ErrInvalidWordOrder
+	}
+
+	where, args, err := wordConditions(user, filter)
+	if err != nil {
+		return nil, "", err
+	}
+
+	from := " FROM aux_words_amount awa INNER JOIN words w ON awa.word = w.id WHERE " + where
+
+	ctx := context.Background()
+
+	list := WordList{Words: []WordStatus{}}
+
+	err = m.DB.QueryRow(ctx, "SELECT COUNT(*)"+from, args...).Scan(&list.Total)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if filter.Cursor != "" {
+		cursor, err := decodeWordCursor(filter.Cursor, sort.kind)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if cursor.Sort != filter.Sort+":"+filter.Order {
+			return nil, "", ErrInvalidCursor
+		}
+
+		comparison := ">"
+		if order == "DESC" {
+			comparison = "<"
+		}
+
+		args = append(args, cursor.Value, cursor.ID)
+		from += " AND (" + sort.column + ", awa.id) " + comparison +
+			" ($" + strconv.Itoa(len(args)-1) + "::" + sort.kind + ", $" + strconv.Itoa(len(args)) + ")"
+	}
+
+	args = append(args, filter.Limit+1)
+	query := "SELECT awa.id, w.word, awa.amount, awa.language, awa.status, awa.status_updated_at, awa.first_seen_at, awa.last_seen_at, " + sort.column + "::text" + from +
+		" ORDER BY " + sort.column + " " + order + ", awa.id " + order +
+		" LIMIT $" + strconv.Itoa(len(args))
+
+	rows, err := m.DB.Query(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var last wordCursor
+	for rows.Next() {
+		var w WordStatus
+		current := wordCursor{Sort: filter.Sort + ":" + filter.Order}
+		err := rows.Scan(&current.ID, &w.Word, &w.Amount, &w.Language, &w.Status, &w.StatusUpdatedAt, &w.FirstSeenAt, &w.LastSeenAt, &current.Value)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if len(list.Words) == filter.Limit {
+			return &list, encodeWordCursor(last), nil
+		}
+
+		list.Words = append(list.Words, w)
+		last = current
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	return &list, "", nil
+}
+
+// Growth returns, for each period since the first word the user met, how many
+// distinct words were seen for the first time and the running total. Periods
+// are truncated like UserModel.Report so both can be charted together. Words
+// counted before their dates were kept have no period: they are not new in any
+// of them but the running total starts from them.
+func (m WordModel) Growth(user *User, language string, interval string) ([]WordGrowth, error) {
+	query := `
+		WITH new_words AS (
+			SELECT DATE_TRUNC($3::text, first_seen_at) AS period, COUNT(*) AS amount
+			FROM aux_words_amount
+			WHERE id_user = $1 AND ($2 = '' OR language = $2) AND first_seen_at IS NOT NULL
+			GROUP BY period
+		), before_tracking AS (
+			SELECT COUNT(*) AS amount
+			FROM aux_words_amount
+			WHERE id_user = $1 AND ($2 = '' OR language = $2) AND first_seen_at IS NULL AND amount > 0
+		)
+		SELECT p.period, COALESCE(n.amount, 0), b.amount + SUM(COALESCE(n.amount, 0)) OVER (ORDER BY p.period)
+		FROM (SELECT MIN(period) AS first FROM new_words) AS f, before_tracking b,
+			generate_series(f.first, DATE_TRUNC($3::text, CURRENT_TIMESTAMP), ('1 ' || $3::text)::interval) AS p(period)
+		LEFT JOIN new_words n ON n.period = p.period
+		ORDER BY p.period`
+
+	if !wordIntervals[interval] {
+		return nil, ErrInvalidInterval
+	}
+
+	rows, err := m.DB.Query(context.Background(), query, user.Id.String(), language, interval)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	growth := []WordGrowth{}
+	for rows.Next() {
+		var g WordGrowth
+		err := rows.Scan(&g.Period, &g.New, &g.Total)
+		if err != nil {
+			return nil, err
+		}
+		growth = append(growth, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return growth, nil
+}
+
+// Export returns every word matching the filter, the most seen first, capped
+// at MaxExportWords.
+func (m WordModel) Export(user *User, filter WordFilter) ([]WordExport, error) {
+	where, args, err := wordConditions(user, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	args = append(args, MaxExportWords)
+	query := `
+		SELECT w.word, awa.language, awa.amount, awa.status, COALESCE((
+			SELECT e.sentence
+			FROM word_examples e
+			WHERE e.id_user = awa.id_user AND e.language = awa.language AND e.word = awa.word
+			ORDER BY e.id
+			LIMIT 1
+		), '')
+		FROM aux_words_amount awa
+		INNER JOIN words w ON awa.word = w.id
+		WHERE ` + where + `
+		ORDER BY awa.amount DESC, awa.id
+		LIMIT $` + strconv.Itoa(len(args))
+
+	rows, err := m.DB.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	words := []WordExport{}
+	for rows.Next() {
+		var w WordExport
+		err := rows.Scan(&w.Word, &w.Language, &w.Amount, &w.Status, &w.Example)
+		if err != nil {
+			return nil, err
+		}
+		words = append(words, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return words, nil
+}
+
+// Examples returns the sentences where the user met the word, with the media
+// they come from. An empty language returns the examples of every language.
+func (m WordModel) Examples(user *User, word string, language string) ([]WordExample, error) {
+	query := `
+		SELECT e.sentence, e.start_seconds, m.id, m.title, m.video_id
+		FROM word_examples e
+		INNER JOIN words w ON w.id = e.word
+		INNER JOIN medias m ON m.id = e.id_media
+		WHERE e.id_user = $1 AND w.word = $2 AND ($3 = '' OR e.language = $3)
+		ORDER BY e.id`
+
+	rows, err := m.DB.Query(context.Background(), query, user.Id.String(), word, language)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	examples := []WordExample{}
+	for rows.Next() {
+		var e WordExample
+		err := rows.Scan(&e.Sentence, &e.Start, &e.MediaId, &e.Title, &e.VideoId)
+		if err != nil {
+			return nil, err
+		}
+
+		if e.VideoId != nil && *e.VideoId != "" {
+			link := "https://www.youtube.com/watch?v=" + *e.VideoId + "&t=" + strconv.Itoa(int(e.Start)) + "s"
+			e.Link = &link
+		}
+
+		examples = append(examples, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return examples, nil
+}
+
+// wordConditions turns the filter into the WHERE clause over aux_words_amount
+// awa and words w, with its arguments starting at $1.
+func wordConditions(user *User, filter WordFilter) (string, []any, error) {
+	if filter.Status != "" && !ValidWordStatus(filter.Status) {
+		return "", nil, ErrInvalidWordStatus
+	}
+
+	where := []string{"awa.id_user = $1"}
+	args := []any{user.Id.String()}
+
+	addFilter := func(condition string, value any) {
+		args = append(args, value)
+		where = append(where, strings.ReplaceAll(condition, "?", "$"+strconv.Itoa(len(args))))
+	}
+
+	if filter.Language != "" {
+		addFilter("awa.language = ?", filter.Language)
+	}
+
+	if filter.Status != "" {
+		addFilter("awa.status = ?", filter.Status)
+	}
+
+	if filter.Search != "" {
+		pattern := escapeLike(strings.ToLower(filter.Search)) + "%"
+		switch filter.Match {
+		case "", "prefix":
+		case "substring":
+			pattern = "%" + pattern
+		default:
+			return "", nil, ErrInvalidWordMatch
+		}
+		addFilter("w.word LIKE ?", pattern)
+	}
+
+	if filter.Min != nil {
+		addFilter("awa.amount > ?", *filter.Min)
+	}
+
+	if filter.Max != nil {
+		addFilter("awa.amount < ?", *filter.Max)
+	}
+
+	return strings.Join(where, " AND "), args, nil
+}
+
+func encodeWordCursor(cursor wordCursor) string {
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// cursorTimeLayouts are the ways Postgres writes a timestamptz as text, the
+// offset having minutes or seconds only when they are not zero.
+var cursorTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999Z07",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999Z07:00:00",
+}
+
+// decodeWordCursor reads a cursor and checks that its value can be cast to
+// the type of the sort column, the cursor comes from the client and may have
+// been changed.
+func decodeWordCursor(value string, kind string) (wordCursor, error) {
+	var cursor wordCursor
+
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+
+	err = json.Unmarshal(raw, &cursor)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+
+	switch kind {
+	case "bigint":
+		_, err = strconv.ParseInt(cursor.Value, 10, 64)
+		if err != nil {
+			return cursor, ErrInvalidCursor
+		}
+	case "timestamptz":
+		if cursor.Value == "-infinity" {
+			break
+		}
+		for _, layout := range cursorTimeLayouts {
+			_, err = time.Parse(layout, cursor.Value)
+			if err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return cursor, ErrInvalidCursor
+		}
+	case "text":
+		// Postgres text cannot hold NUL bytes
+		if strings.ContainsRune(cursor.Value, 0) || !utf8.ValidString(cursor.Value) {
+			return cursor, ErrInvalidCursor
+		}
+	}
+
+	return cursor, nil
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
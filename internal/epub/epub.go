@@ -0,0 +1,241 @@
+// Package epub reads the metadata and the plain text chapters of EPUB files.
+package epub
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var (
+	ErrInvalidEpub = errors.New("the file is not a valid EPUB")
+)
+
+// maxDocumentSize bounds a single chapter, EPUB chapters are rarely over a few
+// hundred kilobytes.
+const maxDocumentSize = 16 << 20
+
+type Book struct {
+	Title    string
+	Author   string
+	Language string
+	Chapters []Chapter
+}
+
+type Chapter struct {
+	Title string
+	Text  string
+}
+
+type container struct {
+	Rootfiles []struct {
+		FullPath string `xml:"full-path,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+type packageDocument struct {
+	Metadata struct {
+		Titles    []string `xml:"title"`
+		Creators  []string `xml:"creator"`
+		Languages []string `xml:"language"`
+	} `xml:"metadata"`
+	Manifest []struct {
+		ID        string `xml:"id,attr"`
+		Href      string `xml:"href,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"manifest>item"`
+	Spine []struct {
+		IDRef  string `xml:"idref,attr"`
+		Linear string `xml:"linear,attr"`
+	} `xml:"spine>itemref"`
+}
+
+// Parse reads an EPUB archive. The chapters follow the reading order of the
+// book and documents without text, like covers, are skipped.
+func Parse(r io.ReaderAt, size int64) (*Book, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, ErrInvalidEpub
+	}
+
+	files := make(map[string]*zip.File)
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	var c container
+	err = decodeXML(files["META-INF/container.xml"], &c)
+	if err != nil || len(c.Rootfiles) == 0 {
+		return nil, ErrInvalidEpub
+	}
+
+	rootPath := c.Rootfiles[0].FullPath
+
+	var pkg packageDocument
+	err = decodeXML(files[rootPath], &pkg)
+	if err != nil {
+		return nil, ErrInvalidEpub
+	}
+
+	book := Book{
+		Title:    first(pkg.Metadata.Titles),
+		Author:   first(pkg.Metadata.Creators),
+		Language: first(pkg.Metadata.Languages),
+	}
+
+	hrefs := make(map[string]string)
+	for _, item := range pkg.Manifest {
+		if item.MediaType == "application/xhtml+xml" || item.MediaType == "text/html" {
+			hrefs[item.ID] = item.Href
+		}
+	}
+
+	base := path.Dir(rootPath)
+	for _, itemRef := range pkg.Spine {
+		href, ok := hrefs[itemRef.IDRef]
+		if !ok || itemRef.Linear == "no" {
+			continue
+		}
+
+		// hrefs are relative to the package document and may be escaped or carry a fragment
+		href = strings.SplitN(href, "#", 2)[0]
+		if unescaped, err := url.PathUnescape(href); err == nil {
+			href = unescaped
+		}
+
+		file := files[path.Join(base, href)]
+		if file == nil {
+			continue
+		}
+
+		chapter, err := readChapter(file)
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.TrimSpace(chapter.Text) == "" {
+			continue
+		}
+
+		if chapter.Title == "" {
+			chapter.Title = strings.TrimSuffix(path.Base(href), path.Ext(href))
+		}
+
+		book.Chapters = append(book.Chapters, chapter)
+	}
+
+	if len(book.Chapters) == 0 {
+		return nil, ErrInvalidEpub
+	}
+
+	return &book, nil
+}
+
+func decodeXML(file *zip.File, dst any) error {
+	if file == nil {
+		return ErrInvalidEpub
+	}
+
+	rc, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	return xml.NewDecoder(io.LimitReader(rc, maxDocumentSize)).Decode(dst)
+}
+
+// readChapter extracts the text of a XHTML document, one line per block, and
+// takes the first heading as the chapter title.
+func readChapter(file *zip.File) (Chapter, error) {
+	var chapter Chapter
+
+	rc, err := file.Open()
+	if err != nil {
+		return chapter, err
+	}
+	defer rc.Close()
+
+	doc, err := html.Parse(io.LimitReader(rc, maxDocumentSize))
+	if err != nil {
+		return chapter, ErrInvalidEpub
+	}
+
+	var text strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "script", "style", "head":
+				return
+			case "h1", "h2", "h3":
+				if chapter.Title == "" {
+					chapter.Title = strings.Join(strings.Fields(nodeText(n)), " ")
+				}
+			}
+		}
+
+		if n.Type == html.TextNode {
+			text.WriteString(n.Data)
+		}
+
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+
+		if n.Type == html.ElementNode && isBlock(n.Data) {
+			text.WriteString("\n")
+		}
+	}
+	walk(doc)
+
+	lines := []string{}
+	for _, line := range strings.Split(text.String(), "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	chapter.Text = strings.Join(lines, "\n")
+
+	return chapter, nil
+}
+
+func nodeText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+
+	var text strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		text.WriteString(nodeText(child))
+	}
+
+	return text.String()
+}
+
+func isBlock(tag string) bool {
+	switch tag {
+	case "p", "div", "br", "li", "h1", "h2", "h3", "h4", "h5", "h6", "blockquote", "tr", "section":
+		return true
+	}
+
+	return false
+}
+
+func first(values []string) string {
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
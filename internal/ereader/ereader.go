@@ -0,0 +1,259 @@
+// Package ereader reads the reading history kept by e-readers: Kindle
+// clippings and KOReader statistics databases.
+package ereader
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+var (
+	ErrNoReadings = errors.New("the file does not contain any reading with pages and dates")
+)
+
+// Book is a book found in the file with the days it was read.
+type Book struct {
+	Title      string
+	Author     string
+	Language   string
+	TotalPages int
+	Days       []Day
+}
+
+// Day sums what was read in a book on a day. Date is the last reading of the
+// day, Page the furthest page reached that day.
+type Day struct {
+	Date     time.Time
+	Page     int
+	Duration time.Duration
+}
+
+var (
+	clippingTitle = regexp.MustCompile(`^(.*?)\s*\(([^()]*)\)$`)
+	clippingPage  = regexp.MustCompile(`(?i)\bpage\s+(\d+)`)
+	clippingAdded = regexp.MustCompile(`(?i)\|\s*Added on\s+(.+)$`)
+)
+
+// clippingDates are the date formats of English Kindle clippings, US and UK.
+var clippingDates = []string{
+	"Monday, January 2, 2006 3:04:05 PM",
+	"Monday, 2 January 2006 15:04:05",
+	"Monday, January 2, 2006, 3:04:05 PM",
+}
+
+// ParseClippings reads a Kindle "My Clippings.txt" file. Clippings only have
+// a page and a date, so each day keeps the furthest page and no reading time.
+// Clippings without a page or with a date in another language are skipped.
+// The dates carry no timezone, they are read in loc, the timezone of the user.
+func ParseClippings(r io.Reader, loc *time.Location) ([]Book, error) {
+	books := make(map[string]*Book)
+	var order []string
+
+	var entry []string
+	flush := func() {
+		defer func() { entry = entry[:0] }()
+
+		if len(entry) < 2 {
+			return
+		}
+
+		title, author := strings.TrimSpace(entry[0]), ""
+		if match := clippingTitle.FindStringSubmatch(title); match != nil {
+			title, author = match[1], match[2]
+		}
+
+		page := clippingPage.FindStringSubmatch(entry[1])
+		added := clippingAdded.FindStringSubmatch(entry[1])
+		if title == "" || page == nil || added == nil {
+			return
+		}
+
+		pageNumber, err := strconv.Atoi(page[1])
+		if err != nil {
+			return
+		}
+
+		var date time.Time
+		for _, layout := range clippingDates {
+			date, err = time.ParseInLocation(layout, strings.TrimSpace(added[1]), loc)
+			if err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return
+		}
+
+		book, ok := books[title]
+		if !ok {
+			book = &Book{Title: title, Author: author}
+			books[title] = book
+			order = append(order, title)
+		}
+
+		book.Days = append(book.Days, Day{Date: date, Page: pageNumber})
+		book.TotalPages = max(book.TotalPages, pageNumber)
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimPrefix(scanner.Text(), "\ufeff")
+
+		if strings.HasPrefix(line, "==========") {
+			flush()
+			continue
+		}
+
+		if strings.TrimSpace(line) == "" && len(entry) < 2 {
+			continue
+		}
+
+		entry = append(entry, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+
+	result := []Book{}
+	for _, title := range order {
+		book := books[title]
+		book.Days = groupDays(book.Days)
+		result = append(result, *book)
+	}
+
+	if len(result) == 0 {
+		return nil, ErrNoReadings
+	}
+
+	return result, nil
+}
+
+// ReadKOReaderStatistics reads the page turns of a KOReader statistics.sqlite3
+// database. Pages are scaled to the current page count of each book, since
+// KOReader records them with the layout used at the time of reading. The page
+// turns are grouped by the days of loc, the timezone of the user.
+func ReadKOReaderStatistics(path string, loc *time.Location) ([]Book, error) {
+	queryBooks := "SELECT id, COALESCE(title, ''), COALESCE(authors, ''), COALESCE(language, ''), COALESCE(pages, 0) FROM book"
+	queryPages := "SELECT page, start_time, duration, total_pages FROM page_stat_data WHERE id_book = ? ORDER BY start_time"
+
+	ctx := context.Background()
+
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.QueryContext(ctx, queryBooks)
+	if err != nil {
+		return nil, err
+	}
+
+	type koreaderBook struct {
+		id int64
+		Book
+	}
+
+	var found []koreaderBook
+	for rows.Next() {
+		var b koreaderBook
+		err := rows.Scan(&b.id, &b.Title, &b.Author, &b.Language, &b.TotalPages)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		found = append(found, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := []Book{}
+	for _, b := range found {
+		rows, err := db.QueryContext(ctx, queryPages, b.id)
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			var page, totalPages int
+			var start, duration int64
+			err := rows.Scan(&page, &start, &duration, &totalPages)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+
+			if b.TotalPages > 0 && totalPages > 0 && totalPages != b.TotalPages {
+				page = page * b.TotalPages / totalPages
+			}
+
+			b.Days = append(b.Days, Day{
+				Date:     time.Unix(start, 0).In(loc),
+				Page:     page,
+				Duration: time.Duration(duration) * time.Second,
+			})
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		if strings.TrimSpace(b.Title) == "" || len(b.Days) == 0 {
+			continue
+		}
+
+		b.Days = groupDays(b.Days)
+		for _, day := range b.Days {
+			b.TotalPages = max(b.TotalPages, day.Page)
+		}
+
+		result = append(result, b.Book)
+	}
+
+	if len(result) == 0 {
+		return nil, ErrNoReadings
+	}
+
+	return result, nil
+}
+
+// groupDays merges the readings of a same day, ordered by date. The day of a
+// reading is read in its own location.
+func groupDays(readings []Day) []Day {
+	sort.Slice(readings, func(i, j int) bool {
+		return readings[i].Date.Before(readings[j].Date)
+	})
+
+	days := []Day{}
+	for _, reading := range readings {
+		last := len(days) - 1
+		if last >= 0 && sameDay(days[last].Date, reading.Date) {
+			days[last].Date = reading.Date
+			days[last].Page = max(days[last].Page, reading.Page)
+			days[last].Duration += reading.Duration
+			continue
+		}
+
+		days = append(days, reading)
+	}
+
+	return days
+}
+
+func sameDay(a time.Time, b time.Time) bool {
+	return a.Format(time.DateOnly) == b.Format(time.DateOnly)
+}
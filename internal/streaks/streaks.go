@@ -0,0 +1,173 @@
+// Package streaks computes the streaks of consecutive days with activity, for
+// each kind of activity and for all of them together.
+package streaks
+
+import (
+	"sort"
+	"time"
+)
+
+// The kinds of activity tracked, Overall is any of them. Listening is the
+// audiobooks, Books the books that are read.
+const (
+	KindAnki      = "anki"
+	KindMedia     = "media"
+	KindTalk      = "talk"
+	KindBooks     = "books"
+	KindListening = "listening"
+	KindJournal   = "journal"
+	KindOverall   = "overall"
+)
+
+var Kinds = []string{KindAnki, KindMedia, KindTalk, KindBooks, KindListening, KindJournal}
+
+// Streak is the current and the longest run of days with activity. Frozen
+// days keep a streak alive but are not counted in its length.
+type Streak struct {
+	Current     int        `json:"current"`
+	Longest     int        `json:"longest"`
+	ActiveToday bool       `json:"activeToday"`
+	FrozenDays  int        `json:"frozenDays"`
+	LastActive  *time.Time `json:"lastActive"`
+}
+
+// Summary holds the streak of every kind of activity and the overall one.
+type Summary struct {
+	Overall    Streak            `json:"overall"`
+	Activities map[string]Streak `json:"activities"`
+}
+
+// Options configure the computation. Today is a time in the timezone of the
+// user, FreezesPerMonth is how many missed days of each calendar month are
+// forgiven, zero turns the freezes off.
+type Options struct {
+	Today           time.Time
+	FreezesPerMonth int
+}
+
+// day is a calendar day counted from the Unix epoch, so consecutive days
+// differ by one whatever the daylight saving changes.
+type day int64
+
+func toDay(t time.Time) day {
+	y, m, d := t.Date()
+	return day(time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / 86400)
+}
+
+func (d day) time() time.Time {
+	return time.Unix(int64(d)*86400, 0).UTC()
+}
+
+func (d day) month() int {
+	y, m, _ := d.time().Date()
+	return y*12 + int(m)
+}
+
+// freezes spends the monthly freezes of the user on missed days.
+type freezes struct {
+	perMonth int
+	used     map[int]int
+}
+
+// cover freezes the days from first to last if every one of them can be
+// frozen, otherwise it spends nothing.
+func (f *freezes) cover(first day, last day) bool {
+	if last < first {
+		return true
+	}
+	if f.perMonth == 0 {
+		return false
+	}
+
+	needed := map[int]int{}
+	for d := first; d <= last; d++ {
+		month := d.month()
+		needed[month]++
+		if f.used[month]+needed[month] > f.perMonth {
+			return false
+		}
+	}
+
+	for month, n := range needed {
+		f.used[month] += n
+	}
+
+	return true
+}
+
+// Compute finds the streaks of the activities done at the given times. The
+// calendar day of a time is read in its own location, so the times must be in
+// the timezone of the user.
+func Compute(times []time.Time, opts Options) Streak {
+	seen := map[day]bool{}
+	days := make([]day, 0, len(times))
+	for _, t := range times {
+		if t.IsZero() {
+			continue
+		}
+		d := toDay(t)
+		if !seen[d] {
+			seen[d] = true
+			days = append(days, d)
+		}
+	}
+
+	var streak Streak
+	if len(days) == 0 {
+		return streak
+	}
+
+	sort.Slice(days, func(i, j int) bool { return days[i] < days[j] })
+
+	f := &freezes{perMonth: opts.FreezesPerMonth, used: map[int]int{}}
+
+	run, frozen := 1, 0
+	streak.Longest = 1
+	for i := 1; i < len(days); i++ {
+		switch {
+		case days[i] == days[i-1]+1:
+			run++
+		case f.cover(days[i-1]+1, days[i]-1):
+			run++
+			frozen += int(days[i] - days[i-1] - 1)
+		default:
+			run, frozen = 1, 0
+		}
+
+		streak.Longest = max(streak.Longest, run)
+	}
+
+	today := toDay(opts.Today)
+	last := days[len(days)-1]
+
+	lastActive := last.time()
+	streak.LastActive = &lastActive
+	streak.ActiveToday = last == today
+
+	// today is not over, missing it does not break the streak yet
+	if last >= today-1 || f.cover(last+1, today-1) {
+		streak.Current = run
+		streak.FrozenDays = frozen
+		if last < today-1 {
+			streak.FrozenDays += int(today - 1 - last)
+		}
+	}
+
+	return streak
+}
+
+// Summarize computes the streak of each kind of activity and the overall
+// streak from the times of the activities by kind.
+func Summarize(activities map[string][]time.Time, opts Options) Summary {
+	summary := Summary{Activities: map[string]Streak{}}
+
+	var all []time.Time
+	for _, kind := range Kinds {
+		summary.Activities[kind] = Compute(activities[kind], opts)
+		all = append(all, activities[kind]...)
+	}
+
+	summary.Overall = Compute(all, opts)
+
+	return summary
+}
@@ -0,0 +1,230 @@
+package streaks
+
+import (
+	"testing"
+	"time"
+)
+
+func date(month time.Month, d int) time.Time {
+	return time.Date(2024, month, d, 12, 0, 0, 0, time.UTC)
+}
+
+func dates(month time.Month, days ...int) []time.Time {
+	times := make([]time.Time, 0, len(days))
+	for _, d := range days {
+		times = append(times, date(month, d))
+	}
+	return times
+}
+
+func TestCompute(t *testing.T) {
+	tests := []struct {
+		name        string
+		times       []time.Time
+		today       time.Time
+		freezes     int
+		current     int
+		longest     int
+		frozen      int
+		activeToday bool
+	}{
+		{
+			name:  "no activity",
+			today: date(time.March, 10),
+		},
+		{
+			name:        "active today",
+			times:       dates(time.March, 8, 9, 10),
+			today:       date(time.March, 10),
+			current:     3,
+			longest:     3,
+			activeToday: true,
+		},
+		{
+			name:    "last day yesterday",
+			times:   dates(time.March, 7, 8, 9),
+			today:   date(time.March, 10),
+			current: 3,
+			longest: 3,
+		},
+		{
+			name:    "broken without freezes",
+			times:   dates(time.March, 1, 2, 3, 7),
+			today:   date(time.March, 9),
+			longest: 3,
+		},
+		{
+			name:        "same day counted once",
+			times:       []time.Time{date(time.March, 9), date(time.March, 9).Add(time.Hour), date(time.March, 10)},
+			today:       date(time.March, 10),
+			current:     2,
+			longest:     2,
+			activeToday: true,
+		},
+		{
+			name:        "gaps frozen in two months",
+			times:       []time.Time{date(time.January, 30), date(time.February, 1), date(time.February, 3)},
+			today:       date(time.February, 3),
+			freezes:     1,
+			current:     3,
+			longest:     3,
+			frozen:      2,
+			activeToday: true,
+		},
+		{
+			name:        "gap across the month boundary uses a freeze of each month",
+			times:       []time.Time{date(time.January, 30), date(time.February, 2)},
+			today:       date(time.February, 2),
+			freezes:     1,
+			current:     2,
+			longest:     2,
+			frozen:      2,
+			activeToday: true,
+		},
+		{
+			name:        "gap across the month boundary without the freeze of the first month",
+			times:       []time.Time{date(time.January, 28), date(time.January, 30), date(time.February, 2)},
+			today:       date(time.February, 2),
+			freezes:     1,
+			current:     1,
+			longest:     2,
+			activeToday: true,
+		},
+		{
+			name:        "freezes run out",
+			times:       dates(time.March, 1, 3, 5),
+			today:       date(time.March, 5),
+			freezes:     1,
+			current:     1,
+			longest:     2,
+			activeToday: true,
+		},
+		{
+			name:        "gap longer than the freezes",
+			times:       dates(time.March, 1, 4),
+			today:       date(time.March, 4),
+			freezes:     1,
+			current:     1,
+			longest:     1,
+			activeToday: true,
+		},
+		{
+			name:    "days missed up to yesterday are frozen",
+			times:   dates(time.March, 1, 2),
+			today:   date(time.March, 5),
+			freezes: 2,
+			current: 2,
+			longest: 2,
+			frozen:  2,
+		},
+		{
+			name:    "days missed up to yesterday past the freezes",
+			times:   dates(time.March, 1, 2),
+			today:   date(time.March, 6),
+			freezes: 2,
+			longest: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			streak := Compute(tt.times, Options{Today: tt.today, FreezesPerMonth: tt.freezes})
+
+			if streak.Current != tt.current || streak.Longest != tt.longest || streak.FrozenDays != tt.frozen || streak.ActiveToday != tt.activeToday {
+				t.Errorf("streak = %+v, want current %d, longest %d, frozen %d, active today %t",
+					streak, tt.current, tt.longest, tt.frozen, tt.activeToday)
+			}
+
+			if len(tt.times) > 0 && streak.LastActive == nil {
+				t.Errorf("last active is nil")
+			}
+		})
+	}
+}
+
+func TestComputeDaylightSaving(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("timezone data not available: %v", err)
+	}
+
+	at := func(month time.Month, d int, hour int, min int) time.Time {
+		return time.Date(2024, month, d, hour, min, 0, 0, loc)
+	}
+
+	tests := []struct {
+		name    string
+		times   []time.Time
+		today   time.Time
+		current int
+	}{
+		{
+			// the 10th has 23 hours, late evening and just after midnight
+			// are the same UTC day but two days of the user
+			name:    "spring forward",
+			times:   []time.Time{at(time.March, 9, 23, 30), at(time.March, 10, 0, 30), at(time.March, 11, 8, 0)},
+			today:   at(time.March, 11, 20, 0),
+			current: 3,
+		},
+		{
+			// the 3rd has 25 hours
+			name:    "fall back",
+			times:   []time.Time{at(time.November, 2, 23, 0), at(time.November, 3, 23, 30), at(time.November, 4, 0, 10)},
+			today:   at(time.November, 4, 23, 0),
+			current: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			streak := Compute(tt.times, Options{Today: tt.today})
+
+			if streak.Current != tt.current || !streak.ActiveToday {
+				t.Errorf("streak = %+v, want current %d and active today", streak, tt.current)
+			}
+
+			want := tt.today
+			if y, m, d := streak.LastActive.Date(); y != want.Year() || m != want.Month() || d != want.Day() {
+				t.Errorf("last active = %v, want the day of %v", streak.LastActive, want)
+			}
+		})
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	activities := map[string][]time.Time{
+		KindMedia:     dates(time.March, 7, 8),
+		KindBooks:     dates(time.March, 9),
+		KindListening: dates(time.March, 10),
+		"unknown":     dates(time.March, 6),
+	}
+
+	summary := Summarize(activities, Options{Today: date(time.March, 10)})
+
+	if len(summary.Activities) != len(Kinds) {
+		t.Errorf("activities = %v, want one streak for each of %v", summary.Activities, Kinds)
+	}
+
+	tests := []struct {
+		kind    string
+		current int
+		longest int
+	}{
+		{KindMedia, 0, 2},
+		{KindBooks, 1, 1},
+		{KindListening, 1, 1},
+		{KindAnki, 0, 0},
+	}
+
+	for _, tt := range tests {
+		streak := summary.Activities[tt.kind]
+		if streak.Current != tt.current || streak.Longest != tt.longest {
+			t.Errorf("%s streak = %+v, want current %d, longest %d", tt.kind, streak, tt.current, tt.longest)
+		}
+	}
+
+	// the kinds that are not tracked are not part of the overall streak
+	if summary.Overall.Current != 4 || summary.Overall.Longest != 4 || !summary.Overall.ActiveToday {
+		t.Errorf("overall streak = %+v, want current 4, longest 4 and active today", summary.Overall)
+	}
+}
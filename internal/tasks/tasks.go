@@ -3,6 +3,7 @@ package tasks
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"language-tracker/internal/jsonlog"
 	"log"
@@ -11,10 +12,11 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
-	youtubetranscript "github.com/dougbarrett/youtube-transcript"
 	"github.com/gocolly/colly"
 	"github.com/hibiken/asynq"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
 	"github.com/resend/resend-go/v2"
@@ -25,6 +27,8 @@ const (
 	TypeTranscript               = "media:transcript"
 	TypeRecoveryPasswordDelivery = "emailPassword:deliver"
 	TypeDeleteWords              = "media:delete"
+	TypeBookWords                = "book:words"
+	TypeDeleteBookWords          = "book:delete"
 )
 
 type EmailDeliveryPayload struct {
@@ -47,6 +51,11 @@ type DeleteWordsPayload struct {
 	YoutubeId      string
 }
 
+type BookWordsPayload struct {
+	UserId string
+	BookId string
+}
+
 func parseISO8601Duration(iso8601 string) (string, error) {
 	re := regexp.MustCompile(`PT(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?`)
 	matches := re.FindStringSubmatch(iso8601)
@@ -111,6 +120,24 @@ func NewDeleteWordsTask(userId string, youtubeId string, targetLanguage string)
 	return asynq.NewTask(TypeDeleteWords, payload), nil
 }
 
+func NewBookWordsTask(userId string, bookId string) (*asynq.Task, error) {
+	payload, err := json.Marshal(BookWordsPayload{UserId: userId, BookId: bookId})
+	if err != nil {
+		return nil, err
+	}
+
+	return asynq.NewTask(TypeBookWords, payload), nil
+}
+
+func NewDeleteBookWordsTask(userId string, bookId string) (*asynq.Task, error) {
+	payload, err := json.Marshal(BookWordsPayload{UserId: userId, BookId: bookId})
+	if err != nil {
+		return nil, err
+	}
+
+	return asynq.NewTask(TypeDeleteBookWords, payload), nil
+}
+
 func NewRecoveryPasswordTask(userId string, tmplID string, userEmail string, token string) (*asynq.Task, error) {
 	payload, err := json.Marshal(EmailDeliveryPayload{UserID: userId, TemplateID: tmplID, UserEmail: userEmail, Token: token})
 	if err != nil {
@@ -188,16 +215,19 @@ func HandleTranscriptTask(ctx context.Context, t *asynq.Task, rdb *redis.Client,
 	if err := json.Unmarshal(t.Payload(), &y); err != nil {
 		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
 	}
-	opts := []youtubetranscript.Option{
-		youtubetranscript.WithLang(y.TargetLanguage),
-	}
 	fmt.Println(y.YoutubeUrl)
-	transcript, err := youtubetranscript.GetTranscript(ctx, y.YoutubeUrl, opts...)
+	captions, err := FetchCaptions(ctx, y.YoutubeUrl, y.TargetLanguage)
 
 	if err != nil && !strings.Contains(err.Error(), "no transcript found") {
 		return err
 	}
 
+	lines := make([]string, 0, len(captions))
+	for _, caption := range captions {
+		lines = append(lines, caption.Text)
+	}
+	transcript := strings.Join(lines, " ")
+
 	var title, duration string
 
 	c := colly.NewCollector()
@@ -219,57 +249,38 @@ func HandleTranscriptTask(ctx context.Context, t *asynq.Task, rdb *redis.Client,
 
 	separeted := strings.Split(transcript, " ")
 
-	insertWords := "INSERT INTO words(word) VALUES($1) RETURNING id, word"
-	searchWords := "SELECT id, word FROM words WHERE word = $1"
-	insertWordsAmount := "INSERT INTO aux_words_amount(id_user, word, amount, language) VALUES ($1, $2, $3, $4) ON CONFLICT (word, id_user) DO UPDATE SET amount = aux_words_amount.amount + EXCLUDED.amount"
-
 	txWords, err := pool.Begin(ctx)
 	if err != nil {
 		fmt.Print(err.Error())
 		return err
 	}
 
-	wordWithoutDuplicates := make(map[string]int)
+	defer txWords.Rollback(ctx)
 
-	totalWords := 0
-	re := regexp.MustCompile(`[\P{L}]+`) // removing digits, whitespaces, symbols and punctuations
-	for _, rawWord := range separeted {
-		word := re.ReplaceAllString(rawWord, "")
+	wordWithoutDuplicates, _ := CountWords(transcript)
 
-		if len(word) <= 2 {
-			continue
+	err = UpsertWords(ctx, txWords, y.UserId, y.MediaId, y.TargetLanguage, nil, wordWithoutDuplicates)
+	if err != nil {
+		fmt.Println(err.Error())
+		if isPermanent(err) {
+			return fmt.Errorf("upsert words failed: %v: %w", err, asynq.SkipRetry)
 		}
-
-		wordWithoutDuplicates[strings.ToLower(word)] += 1
-		totalWords++
+		return err
 	}
 
-	for word, amount := range wordWithoutDuplicates {
-		var id int
-		var wordS string
-
-		errS := txWords.QueryRow(context.Background(), searchWords, word).Scan(&id, &wordS)
-
-		if errS != nil && errS.Error() != `no rows in result set` {
-			fmt.Println(errS.Error())
-			return errS
-		}
-
-		if errS != nil && errS.Error() == `no rows in result set` {
-			errI := txWords.QueryRow(context.Background(), insertWords, word).Scan(&id, &wordS)
-
-			if errI != nil && errI.Error() != `ERROR: duplicate key value violates unique constraint "words_word_key" (SQLSTATE 23505)` {
-				fmt.Println(errI.Error())
-				return errI
-			}
+	err = InsertExamples(ctx, txWords, y.UserId, y.MediaId, y.TargetLanguage, ExtractExamples(captions, MaxExamplesPerWord))
+	if err != nil {
+		fmt.Println(err.Error())
+		if isPermanent(err) {
+			return fmt.Errorf("insert examples failed: %v: %w", err, asynq.SkipRetry)
 		}
+		return err
+	}
 
-		args := []any{y.UserId, &id, amount, y.TargetLanguage}
-		_, errL := txWords.Exec(context.Background(), insertWordsAmount, args...)
-		if errL != nil {
-			fmt.Println(errL)
-			return errL
-		}
+	err = PromoteWords(ctx, txWords, y.UserId, y.TargetLanguage)
+	if err != nil {
+		fmt.Println(err.Error())
+		return err
 	}
 
 	err = txWords.Commit(context.Background())
@@ -280,7 +291,7 @@ func HandleTranscriptTask(ctx context.Context, t *asynq.Task, rdb *redis.Client,
 
 	tx, err := pool.Begin(context.Background())
 
-	query := `UPDATE medias SET total_words = $1, title = $4, time = $5 WHERE id_user = $2 AND id = $3`
+	query := `UPDATE medias SET total_words = $1, title = $4, time = $5, status = 'done', task_error = NULL WHERE id_user = $2 AND id = $3`
 	if err != nil {
 		log.Fatalf("error begin pool %v", err.Error())
 		return err
@@ -308,61 +319,230 @@ func HandleTranscriptTask(ctx context.Context, t *asynq.Task, rdb *redis.Client,
 
 }
 
+// HandleTaskError records on the media entry the error of a transcript task
+// that will not be retried anymore, so the user can see why it failed.
+func HandleTaskError(rdb *redis.Client, pool *pgxpool.Pool) asynq.ErrorHandlerFunc {
+	return func(ctx context.Context, t *asynq.Task, err error) {
+		retried, _ := asynq.GetRetryCount(ctx)
+		maxRetry, _ := asynq.GetMaxRetry(ctx)
+
+		logger := jsonlog.NewLogger(os.Stdout, jsonlog.LevelInfo)
+		logger.PrintError(err, map[string]string{
+			"task":    t.Type(),
+			"retried": strconv.Itoa(retried),
+		})
+
+		if retried < maxRetry && !errors.Is(err, asynq.SkipRetry) {
+			return
+		}
+
+		if t.Type() != TypeTranscript {
+			return
+		}
+
+		var y TranscriptPayload
+		if err := json.Unmarshal(t.Payload(), &y); err != nil {
+			return
+		}
+
+		query := `UPDATE medias SET status = 'failed', task_error = $3 WHERE id_user = $1 AND id = $2`
+
+		_, errU := pool.Exec(context.Background(), query, y.UserId, y.MediaId, err.Error())
+		if errU != nil {
+			logger.PrintError(errU, nil)
+			return
+		}
+
+		rdb.Del(context.Background(), "medias:user:"+y.UserId)
+	}
+}
+
 func HandleDeleteTranscriptTask(ctx context.Context, t *asynq.Task, rdb *redis.Client, pool *pgxpool.Pool) error {
 	var y DeleteWordsPayload
 	if err := json.Unmarshal(t.Payload(), &y); err != nil {
 		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
 	}
-	opts := []youtubetranscript.Option{
-		youtubetranscript.WithLang(y.TargetLanguage),
+	transcript, err := FetchTranscript(ctx, y.YoutubeId, y.TargetLanguage)
+
+	if err != nil && !strings.Contains(err.Error(), "no transcript found") {
+		return err
 	}
 
-	transcript, err := youtubetranscript.GetTranscript(ctx, y.YoutubeId, opts...)
+	txWords, err := pool.Begin(ctx)
+	if err != nil {
+		fmt.Print(err.Error())
+		return err
+	}
 
-	if err != nil && !strings.Contains(err.Error(), "no transcript found") {
+	defer txWords.Rollback(ctx)
+
+	wordWithoutDuplicates, _ := CountWords(transcript)
+
+	err = RemoveWords(ctx, txWords, y.UserId, y.TargetLanguage, wordWithoutDuplicates)
+	if err != nil {
+		fmt.Println(err.Error())
 		return err
 	}
 
-	separeted := strings.Split(transcript, " ")
+	err = txWords.Commit(context.Background())
+	if err != nil {
+		fmt.Println(err.Error())
+		return err
+	}
 
-	deleteWords := "UPDATE SET amount = aux_words.amount - $1 FROM aux_words_amount"
+	return nil
+}
 
-	txWords, err := pool.Begin(ctx)
+// HandleBookWordsTask brings the words of an imported book in line with its
+// history, the pages being spread evenly over the words of its chapters. The
+// words of pages past the furthest page read are taken back, those of pages
+// read since the last run are added to the user words like a transcript.
+func HandleBookWordsTask(ctx context.Context, t *asynq.Task, pool *pgxpool.Pool) error {
+	var p BookWordsPayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
+
+	// the lock keeps two runs for the same book from counting the same pages,
+	// the words are seen when the furthest page was first reached
+	queryBook := `
+		SELECT b.target_language, b.words_to_page,
+			COALESCE((SELECT MAX(total_pages) FROM books_history WHERE id_book = b.id), 0),
+			COALESCE((SELECT MAX(actual_page) FROM books_history WHERE id_book = b.id), 0),
+			COALESCE((SELECT activity_at FROM books_history WHERE id_book = b.id ORDER BY actual_page DESC, activity_at, id LIMIT 1), CURRENT_TIMESTAMP),
+			EXISTS(SELECT 1 FROM book_chapters WHERE id_book = b.id)
+		FROM books b
+		WHERE b.id = $1 AND b.id_user = $2
+		FOR UPDATE`
+	queryChapters := "SELECT content FROM book_chapters WHERE id_book = $1 ORDER BY position"
+	updateCounted := "UPDATE books SET words_to_page = $2 WHERE id = $1"
+
+	tx, err := pool.Begin(ctx)
 	if err != nil {
-		fmt.Print(err.Error())
 		return err
 	}
 
-	wordWithoutDuplicates := make(map[string]int)
+	defer tx.Rollback(ctx)
 
-	totalWords := 0
-	re := regexp.MustCompile(`[\P{L}]+`) // removing digits, whitespaces, symbols and punctuations
-	for _, rawWord := range separeted {
-		word := re.ReplaceAllString(rawWord, "")
+	var language string
+	var countedTo, totalPages, readTo int
+	var readAt time.Time
+	var imported bool
 
-		if len(word) <= 2 {
-			continue
+	err = tx.QueryRow(ctx, queryBook, p.BookId, p.UserId).Scan(&language, &countedTo, &totalPages, &readTo, &readAt, &imported)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("book %s not found: %w", p.BookId, asynq.SkipRetry)
 		}
+		return err
+	}
 
-		wordWithoutDuplicates[strings.ToLower(word)] += 1
-		totalWords++
+	if !imported {
+		return nil
 	}
 
-	for word := range wordWithoutDuplicates {
-		_, err := txWords.Exec(context.Background(), deleteWords, word)
+	// an entry was deleted or edited back, the pages after it are unread again
+	if countedTo > readTo {
+		fromPage, removed, err := removeBookWords(ctx, tx, p.UserId, p.BookId, readTo)
+		if err != nil {
+			return err
+		}
+		if removed {
+			countedTo = min(countedTo, fromPage)
+		}
+	}
+
+	if readTo > countedTo {
+		counts, err := bookPageWords(ctx, tx, queryChapters, p.BookId, countedTo, readTo, totalPages)
+		if err != nil {
+			return err
+		}
+
+		err = UpsertWords(ctx, tx, p.UserId, "", language, &readAt, counts)
+		if err != nil {
+			if isPermanent(err) {
+				return fmt.Errorf("upsert words failed: %v: %w", err, asynq.SkipRetry)
+			}
+			return err
+		}
+
+		err = recordBookWords(ctx, tx, p.UserId, p.BookId, language, countedTo, readTo, counts)
+		if err != nil {
+			return err
+		}
 
+		err = PromoteWords(ctx, tx, p.UserId, language)
 		if err != nil {
-			fmt.Println(err.Error())
 			return err
 		}
 
+		countedTo = readTo
 	}
 
-	err = txWords.Commit(context.Background())
+	_, err = tx.Exec(ctx, updateCounted, p.BookId, countedTo)
 	if err != nil {
-		fmt.Println(err.Error())
 		return err
 	}
 
-	return nil
+	return tx.Commit(ctx)
+}
+
+// bookPageWords counts the words of the pages from fromPage to toPage of a
+// book out of totalPages.
+func bookPageWords(ctx context.Context, tx pgx.Tx, query string, bookId string, fromPage int, toPage int, totalPages int) (map[string]int, error) {
+	rows, err := tx.Query(ctx, query, bookId)
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens []string
+	for rows.Next() {
+		var content string
+		if err := rows.Scan(&content); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tokens = append(tokens, strings.Fields(content)...)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 || totalPages == 0 {
+		return nil, nil
+	}
+
+	from := min(len(tokens), fromPage*len(tokens)/totalPages)
+	to := min(len(tokens), toPage*len(tokens)/totalPages)
+	if from >= to {
+		return nil, nil
+	}
+
+	counts, _ := CountWords(strings.Join(tokens[from:to], " "))
+
+	return counts, nil
+}
+
+// HandleDeleteBookWordsTask takes back the words a deleted book added to the
+// user words.
+func HandleDeleteBookWordsTask(ctx context.Context, t *asynq.Task, pool *pgxpool.Pool) error {
+	var p BookWordsPayload
+	if err := json.Unmarshal(t.Payload(), &p); err != nil {
+		return fmt.Errorf("json.Unmarshal failed: %v: %w", err, asynq.SkipRetry)
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	_, _, err = removeBookWords(ctx, tx, p.UserId, p.BookId, 0)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
 }
@@ -0,0 +1,213 @@
+package tasks
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode"
+
+	youtubetranscript "github.com/dougbarrett/youtube-transcript"
+)
+
+var (
+	nonLetters     = regexp.MustCompile(`[\P{L}]+`) // removing digits, whitespaces, symbols and punctuations
+	subtitleTiming = regexp.MustCompile(`^\d{1,2}:\d{2}(:\d{2})?[.,]\d{3}\s*-->`)
+	subtitleTags   = regexp.MustCompile(`<[^>]*>|\{[^}]*\}`)
+)
+
+// MaxExamplesPerWord is how many sentences are kept for each word of a user.
+const MaxExamplesPerWord = 3
+
+// maxSentenceWords cuts automatic captions, which have no punctuation, into
+// sentences of a readable size.
+const maxSentenceWords = 25
+
+// Caption is a timed line of a video transcript.
+type Caption struct {
+	Text  string
+	Start float64
+}
+
+// Example is a sentence where a word appears and the second it starts at.
+type Example struct {
+	Sentence string
+	Start    float64
+}
+
+// FetchTranscript returns the plain text captions of a youtube video in the given language.
+func FetchTranscript(ctx context.Context, videoId string, language string) (string, error) {
+	captions, err := FetchCaptions(ctx, videoId, language)
+	if err != nil {
+		return "", err
+	}
+
+	lines := make([]string, 0, len(captions))
+	for _, caption := range captions {
+		lines = append(lines, caption.Text)
+	}
+
+	return strings.Join(lines, " "), nil
+}
+
+// FetchCaptions returns the timed captions of a youtube video in the given language.
+func FetchCaptions(ctx context.Context, videoId string, language string) ([]Caption, error) {
+	transcripts, err := youtubetranscript.NewTranscriptListFetcher(http.DefaultClient).Fetch(videoId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list transcripts: %w", err)
+	}
+
+	transcript, err := transcripts.FindTranscript([]string{language})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find transcripts for language %s: %w", language, err)
+	}
+
+	lines, err := transcript.Fetch(false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch transcript: %w", err)
+	}
+
+	captions := make([]Caption, 0, len(lines))
+	for _, line := range lines {
+		captions = append(captions, Caption{Text: line.Text, Start: line.Start})
+	}
+
+	return captions, nil
+}
+
+// ExtractExamples joins the captions into sentences and keeps, for each
+// normalized word, the first perWord sentences it appears in.
+func ExtractExamples(captions []Caption, perWord int) map[string][]Example {
+	examples := make(map[string][]Example)
+
+	var sentence []string
+	var start float64
+
+	flush := func() {
+		if len(sentence) < 3 {
+			sentence = sentence[:0]
+			return
+		}
+
+		text := strings.Join(sentence, " ")
+		seen := make(map[string]bool)
+		for _, rawWord := range sentence {
+			word := NormalizeWord(rawWord)
+			if word == "" || seen[word] || len(examples[word]) >= perWord {
+				continue
+			}
+
+			seen[word] = true
+			examples[word] = append(examples[word], Example{Sentence: text, Start: start})
+		}
+
+		sentence = sentence[:0]
+	}
+
+	for _, caption := range captions {
+		for _, token := range strings.Fields(caption.Text) {
+			if len(sentence) == 0 {
+				start = caption.Start
+			}
+
+			sentence = append(sentence, token)
+
+			if endsSentence(token) || len(sentence) >= maxSentenceWords {
+				flush()
+			}
+		}
+	}
+	flush()
+
+	return examples
+}
+
+func endsSentence(token string) bool {
+	token = strings.TrimRightFunc(token, func(r rune) bool {
+		return r == '"' || r == '\'' || r == ')' || r == '»' || r == '”'
+	})
+
+	last := []rune(token)
+	if len(last) == 0 {
+		return false
+	}
+
+	r := last[len(last)-1]
+	return r == '…' || unicode.Is(unicode.Sentence_Terminal, r)
+}
+
+// ParseSubtitles extracts the spoken text of a SRT or WebVTT file, dropping
+// cue numbers, timings, headers and formatting tags.
+func ParseSubtitles(r io.Reader) (string, error) {
+	var lines []string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "WEBVTT"), strings.HasPrefix(line, "NOTE"), strings.HasPrefix(line, "STYLE"):
+			continue
+		case subtitleTiming.MatchString(line):
+			continue
+		case isDigits(line):
+			continue
+		}
+
+		lines = append(lines, subtitleTags.ReplaceAllString(line, ""))
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	return strings.Join(lines, " "), nil
+}
+
+// CountWords normalizes a transcript into lower case words, skipping anything
+// with two letters or less, and returns how many times each word appears
+// together with the number of counted tokens.
+func CountWords(transcript string) (map[string]int, int) {
+	words := make(map[string]int)
+
+	totalWords := 0
+	for _, rawWord := range strings.Fields(transcript) {
+		word := NormalizeWord(rawWord)
+
+		if word == "" {
+			continue
+		}
+
+		words[word] += 1
+		totalWords++
+	}
+
+	return words, totalWords
+}
+
+// NormalizeWord returns the lower case letters of a raw token, or an empty
+// string when the token is too short to be tracked.
+func NormalizeWord(rawWord string) string {
+	word := nonLetters.ReplaceAllString(rawWord, "")
+
+	if len(word) <= 2 {
+		return ""
+	}
+
+	return strings.ToLower(word)
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
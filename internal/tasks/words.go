@@ -0,0 +1,338 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	insertWords = `
+		INSERT INTO words(word)
+		SELECT word FROM unnest($1::text[]) AS word
+		ORDER BY word
+		ON CONFLICT (word) DO NOTHING`
+
+	// xmax is only zero for freshly inserted rows, so it tells if this is the first time the user meets the word.
+	// The words are seen at the date given, or at the activity date of the media,
+	// which can be in the past.
+	upsertWordsAmount = `
+		WITH input AS (
+			SELECT w.id AS word, i.amount
+			FROM unnest($2::text[], $3::int[]) AS i(word, amount)
+			INNER JOIN words w ON w.word = i.word
+		), seen AS (
+			SELECT COALESCE($6::timestamptz, (SELECT activity_at FROM medias WHERE id = $5::uuid), CURRENT_TIMESTAMP) AS at
+		), upserted AS (
+			INSERT INTO aux_words_amount(id_user, word, amount, language, first_seen_at, last_seen_at)
+			SELECT $1, word, amount, $4, seen.at, seen.at FROM input, seen
+			ORDER BY word
+			ON CONFLICT (id_user, language, word) DO UPDATE SET
+				amount = aux_words_amount.amount + EXCLUDED.amount,
+				first_seen_at = CASE
+					-- a word counted before the dates were kept stays before tracking
+					WHEN aux_words_amount.first_seen_at IS NULL AND aux_words_amount.amount > 0 THEN NULL
+					ELSE LEAST(aux_words_amount.first_seen_at, EXCLUDED.first_seen_at)
+				END,
+				last_seen_at = GREATEST(aux_words_amount.last_seen_at, EXCLUDED.last_seen_at)
+			RETURNING word, (xmax = 0) AS first_exposure
+		)
+		INSERT INTO media_words(id_media, id_user, word, amount, first_exposure)
+		SELECT $5, $1, i.word, i.amount, u.first_exposure
+		FROM input i
+		INNER JOIN upserted u ON u.word = i.word
+		WHERE $5::uuid IS NOT NULL
+		ON CONFLICT (id_media, word) DO NOTHING`
+
+	// the rank keeps the examples already stored for the user in the language
+	// inside the cap
+	insertExamples = `
+		INSERT INTO word_examples(id_user, id_media, language, word, sentence, start_seconds)
+		SELECT $1, $2, $7, r.word, r.sentence, r.start
+		FROM (
+			SELECT
+				w.id AS word, i.sentence, i.start,
+				ROW_NUMBER() OVER (PARTITION BY w.id ORDER BY i.n) + (
+					SELECT COUNT(*) FROM word_examples e WHERE e.id_user = $1 AND e.language = $7 AND e.word = w.id
+				) AS rank
+			FROM unnest($3::text[], $4::text[], $5::float8[]) WITH ORDINALITY AS i(word, sentence, start, n)
+			INNER JOIN words w ON w.word = i.word
+		) AS r
+		WHERE r.rank <= $6`
+
+	// the rows are locked in the order of upsertWordsAmount, by word id, so a
+	// removal next to a transcript of the same user can not deadlock
+	decreaseWordsAmount = `
+		WITH locked AS (
+			SELECT awa.id, i.amount
+			FROM unnest($2::text[], $3::int[]) AS i(word, amount)
+			INNER JOIN words w ON w.word = i.word
+			INNER JOIN aux_words_amount awa ON awa.word = w.id
+			WHERE awa.id_user = $1
+			  AND awa.language = $4
+			ORDER BY awa.word
+			FOR UPDATE OF awa
+		)
+		UPDATE aux_words_amount awa
+		SET amount = awa.amount - locked.amount
+		FROM locked
+		WHERE awa.id = locked.id`
+
+	// only the decremented words are dropped, and only while nothing else
+	// refers to them: a status set by the user or a review schedule
+	deleteUnusedWords = `
+		DELETE FROM aux_words_amount awa
+		USING words w
+		WHERE awa.id_user = $1
+		  AND awa.language = $2
+		  AND awa.word = w.id
+		  AND w.word = ANY($3)
+		  AND awa.amount <= 0
+		  AND awa.status = 'new'
+		  AND NOT EXISTS (SELECT 1 FROM word_reviews r WHERE r.id_word_amount = awa.id)`
+
+	// the unused words are dropped again by id, the way deleteUnusedWords does
+	deleteUnusedWordIds = `
+		DELETE FROM aux_words_amount awa
+		WHERE awa.id_user = $1
+		  AND awa.language = $2
+		  AND awa.word = ANY($3)
+		  AND awa.amount <= 0
+		  AND awa.status = 'new'
+		  AND NOT EXISTS (SELECT 1 FROM word_reviews r WHERE r.id_word_amount = awa.id)`
+
+	insertBookWords = `
+		INSERT INTO book_words(id_book, id_user, language, from_page, to_page, word, amount)
+		SELECT $1, $2, $3, $4, $5, w.id, i.amount
+		FROM unnest($6::text[], $7::int[]) AS i(word, amount)
+		INNER JOIN words w ON w.word = i.word`
+
+	// the ranges past the page are taken back from the user totals, locking the
+	// rows by word id like decreaseWordsAmount
+	decreaseBookWords = `
+		WITH removed AS (
+			DELETE FROM book_words WHERE id_book = $1 AND to_page > $2
+			RETURNING id_user, language, word, amount
+		), totals AS (
+			SELECT id_user, language, word, SUM(amount) AS amount
+			FROM removed
+			GROUP BY id_user, language, word
+		), locked AS (
+			SELECT awa.id, t.amount
+			FROM totals t
+			INNER JOIN aux_words_amount awa ON awa.id_user = t.id_user AND awa.language = t.language AND awa.word = t.word
+			ORDER BY awa.word
+			FOR UPDATE OF awa
+		)
+		UPDATE aux_words_amount awa
+		SET amount = awa.amount - locked.amount
+		FROM locked
+		WHERE awa.id = locked.id
+		RETURNING awa.language, awa.word`
+
+	// thresholds come from the user configs, zero or missing means disabled
+	promoteWords = `
+		UPDATE aux_words_amount awa
+		SET status = CASE WHEN t.known > 0 AND awa.amount >= t.known THEN 'known' ELSE 'learning' END,
+			status_updated_at = CURRENT_TIMESTAMP
+		FROM (
+			SELECT
+				COALESCE((configs->>'knownThreshold')::int, 0) AS known,
+				COALESCE((configs->>'learningThreshold')::int, 0) AS learning
+			FROM users
+			WHERE id = $1
+		) AS t
+		WHERE awa.id_user = $1
+		  AND awa.language = $2
+		  AND (
+			(t.known > 0 AND awa.amount >= t.known AND awa.status IN ('new', 'learning'))
+			OR (t.learning > 0 AND awa.amount >= t.learning AND awa.status = 'new')
+		  )`
+)
+
+// UpsertWords adds the word counts to the user totals with two statements,
+// whatever the amount of words. When mediaId is not empty the words are also
+// recorded as contributed by that media. The words are seen at seenAt, or at
+// the date of the media when it is nil.
+func UpsertWords(ctx context.Context, tx pgx.Tx, userId string, mediaId string, language string, seenAt *time.Time, counts map[string]int) error {
+	if len(counts) == 0 {
+		return nil
+	}
+
+	words := make([]string, 0, len(counts))
+	for word := range counts {
+		words = append(words, word)
+	}
+	// a stable order keeps concurrent workers from locking rows in opposite directions
+	sort.Strings(words)
+
+	amounts := make([]int32, len(words))
+	for i, word := range words {
+		amounts[i] = int32(counts[word])
+	}
+
+	_, err := tx.Exec(ctx, insertWords, words)
+	if err != nil {
+		return err
+	}
+
+	var media *string
+	if mediaId != "" {
+		media = &mediaId
+	}
+
+	_, err = tx.Exec(ctx, upsertWordsAmount, userId, words, amounts, language, media, seenAt)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// InsertExamples stores the example sentences a media gave for each word,
+// keeping at most MaxExamplesPerWord sentences per word and language for the
+// user. The words must already exist, so it runs after UpsertWords.
+func InsertExamples(ctx context.Context, tx pgx.Tx, userId string, mediaId string, language string, examples map[string][]Example) error {
+	var words, sentences []string
+	var starts []float64
+
+	for word, wordExamples := range examples {
+		for _, example := range wordExamples {
+			words = append(words, word)
+			sentences = append(sentences, example.Sentence)
+			starts = append(starts, example.Start)
+		}
+	}
+
+	if len(words) == 0 {
+		return nil
+	}
+
+	_, err := tx.Exec(ctx, insertExamples, userId, mediaId, words, sentences, starts, MaxExamplesPerWord, language)
+	return err
+}
+
+// PromoteWords moves the words of a language that passed the exposure
+// thresholds of the user to learning or known. Ignored words are left alone.
+func PromoteWords(ctx context.Context, tx pgx.Tx, userId string, language string) error {
+	_, err := tx.Exec(ctx, promoteWords, userId, language)
+	return err
+}
+
+// RemoveWords takes the word counts of a removed media back from the user
+// totals of that language, dropping the words that reach zero unless the
+// user set their status or reviews them.
+func RemoveWords(ctx context.Context, tx pgx.Tx, userId string, language string, counts map[string]int) error {
+	if len(counts) == 0 {
+		return nil
+	}
+
+	words := make([]string, 0, len(counts))
+	for word := range counts {
+		words = append(words, word)
+	}
+	// the same order as UpsertWords
+	sort.Strings(words)
+
+	amounts := make([]int32, len(words))
+	for i, word := range words {
+		amounts[i] = int32(counts[word])
+	}
+
+	_, err := tx.Exec(ctx, decreaseWordsAmount, userId, words, amounts, language)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, deleteUnusedWords, userId, language, words)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// recordBookWords keeps the words the pages from fromPage to toPage of a book
+// added to the user totals, so removeBookWords can take them back. The words
+// must already exist, so it runs after UpsertWords.
+func recordBookWords(ctx context.Context, tx pgx.Tx, userId string, bookId string, language string, fromPage int, toPage int, counts map[string]int) error {
+	if len(counts) == 0 {
+		return nil
+	}
+
+	words := make([]string, 0, len(counts))
+	amounts := make([]int32, 0, len(counts))
+	for word, amount := range counts {
+		words = append(words, word)
+		amounts = append(amounts, int32(amount))
+	}
+
+	_, err := tx.Exec(ctx, insertBookWords, bookId, userId, language, fromPage, toPage, words, amounts)
+	return err
+}
+
+// removeBookWords takes back from the user totals the words recorded for the
+// pages of a book read after the given page, zero for the whole book. It
+// returns the first page no longer counted, or false when nothing was
+// recorded past the page.
+func removeBookWords(ctx context.Context, tx pgx.Tx, userId string, bookId string, page int) (int, bool, error) {
+	var fromPage *int
+	err := tx.QueryRow(ctx, "SELECT MIN(from_page) FROM book_words WHERE id_book = $1 AND to_page > $2", bookId, page).Scan(&fromPage)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if fromPage == nil {
+		return 0, false, nil
+	}
+
+	rows, err := tx.Query(ctx, decreaseBookWords, bookId, page)
+	if err != nil {
+		return 0, false, err
+	}
+
+	decreased := map[string][]int32{}
+	for rows.Next() {
+		var language string
+		var word int32
+		err := rows.Scan(&language, &word)
+		if err != nil {
+			rows.Close()
+			return 0, false, err
+		}
+		decreased[language] = append(decreased[language], word)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, false, err
+	}
+
+	for language, words := range decreased {
+		_, err := tx.Exec(ctx, deleteUnusedWordIds, userId, language, words)
+		if err != nil {
+			return 0, false, err
+		}
+	}
+
+	return *fromPage, true, nil
+}
+
+// isPermanent reports database errors that a retry cannot fix, like a media
+// removed while it was still being processed.
+func isPermanent(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+
+	switch pgErr.Code[:2] {
+	case "22", "23": // data exception, integrity constraint violation
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,99 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// BenchmarkUpsertWords compares the per-word statements the transcript worker
+// used to run against the batched upsert. It needs the DATABASE_URL of a
+// migrated database, every run happens inside a transaction that is rolled
+// back so nothing is left behind.
+func BenchmarkUpsertWords(b *testing.B) {
+	url := os.Getenv("DATABASE_URL")
+	if url == "" {
+		b.Skip("DATABASE_URL is not set")
+	}
+
+	pool, err := pgxpool.New(context.Background(), url)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer pool.Close()
+
+	const distinct = 3000
+
+	counts := make(map[string]int, distinct)
+	for i := 0; i < distinct; i++ {
+		counts[fmt.Sprintf("benchword%c%c%c", 'a'+i%26, 'a'+i/26%26, 'a'+i/676%26)] = 1 + i%7
+	}
+
+	run := func(b *testing.B, upsert func(ctx context.Context, tx pgx.Tx, userId string) error) {
+		for i := 0; i < b.N; i++ {
+			ctx := context.Background()
+
+			tx, err := pool.Begin(ctx)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			userId := uuid.NewString()
+			_, err = tx.Exec(ctx, "INSERT INTO users(id, username, email, password, configs) VALUES($1, $1, $1, '', '{}')", userId)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			err = upsert(ctx, tx, userId)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			tx.Rollback(ctx)
+		}
+	}
+
+	b.Run("per-row", func(b *testing.B) {
+		run(b, func(ctx context.Context, tx pgx.Tx, userId string) error {
+			return perRowUpsert(ctx, tx, userId, "en", counts)
+		})
+	})
+
+	b.Run("batched", func(b *testing.B) {
+		run(b, func(ctx context.Context, tx pgx.Tx, userId string) error {
+			return UpsertWords(ctx, tx, userId, "", "en", nil, counts)
+		})
+	})
+}
+
+// perRowUpsert is the previous worker loop: one lookup, maybe one insert and
+// one upsert for every distinct word.
+func perRowUpsert(ctx context.Context, tx pgx.Tx, userId string, language string, counts map[string]int) error {
+	insertWords := "INSERT INTO words(word) VALUES($1) RETURNING id"
+	searchWords := "SELECT id FROM words WHERE word = $1"
+	insertWordsAmount := "INSERT INTO aux_words_amount(id_user, word, amount, language) VALUES ($1, $2, $3, $4) ON CONFLICT (id_user, language, word) DO UPDATE SET amount = aux_words_amount.amount + EXCLUDED.amount"
+
+	for word, amount := range counts {
+		var id int
+
+		err := tx.QueryRow(ctx, searchWords, word).Scan(&id)
+		if err == pgx.ErrNoRows {
+			err = tx.QueryRow(ctx, insertWords, word).Scan(&id)
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, insertWordsAmount, userId, id, amount, language)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_media_words_user;
+
+DROP TABLE IF EXISTS media_words;
@@ -0,0 +1,11 @@
+CREATE TABLE media_words (
+	id SERIAL PRIMARY KEY,
+	id_media uuid NOT NULL REFERENCES medias(id) ON DELETE CASCADE,
+	id_user uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	word INT NOT NULL REFERENCES words(id),
+	amount INT NOT NULL,
+	first_exposure BOOL DEFAULT false NOT NULL,
+	UNIQUE(id_media, word)
+);
+
+CREATE INDEX idx_media_words_user ON media_words(id_user);
@@ -0,0 +1,20 @@
+ALTER TABLE aux_words_amount DROP CONSTRAINT IF EXISTS aux_words_amount_user_language_word_key;
+
+UPDATE aux_words_amount awa
+SET amount = merged.amount
+FROM (
+	SELECT MIN(id) AS id, SUM(amount) AS amount
+	FROM aux_words_amount
+	GROUP BY id_user, word
+) AS merged
+WHERE awa.id = merged.id;
+
+DELETE FROM aux_words_amount awa
+WHERE EXISTS (
+	SELECT 1 FROM aux_words_amount other
+	WHERE other.id_user = awa.id_user AND other.word = awa.word AND other.id < awa.id
+);
+
+ALTER TABLE aux_words_amount ADD CONSTRAINT aux_words_amount_word_id_user_key UNIQUE (word, id_user);
+
+CREATE UNIQUE INDEX unique_word_user ON aux_words_amount(word, id_user);
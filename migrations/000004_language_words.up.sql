@@ -0,0 +1,28 @@
+ALTER TABLE aux_words_amount DROP CONSTRAINT IF EXISTS aux_words_amount_word_id_user_key;
+
+DROP INDEX IF EXISTS unique_word_user;
+
+-- rows were merged across languages, media_words knows how much each language
+-- contributed. It only exists since 000003, so only the media counted after it
+-- are split: rows from before are left whole in the language they were kept in.
+CREATE TEMPORARY TABLE split_words AS
+SELECT awa.id AS id_original, mw.id_user, mw.word, m.target_language AS language, SUM(mw.amount)::int AS amount
+FROM media_words mw
+INNER JOIN medias m ON m.id = mw.id_media
+INNER JOIN aux_words_amount awa ON awa.id_user = mw.id_user AND awa.word = mw.word
+WHERE m.target_language <> awa.language
+GROUP BY awa.id, mw.id_user, mw.word, m.target_language;
+
+INSERT INTO aux_words_amount(id_user, word, amount, language)
+SELECT id_user, word, amount, language FROM split_words;
+
+UPDATE aux_words_amount awa
+SET amount = awa.amount - moved.amount
+FROM (SELECT id_original, SUM(amount) AS amount FROM split_words GROUP BY id_original) AS moved
+WHERE awa.id = moved.id_original;
+
+DELETE FROM aux_words_amount WHERE amount <= 0;
+
+DROP TABLE split_words;
+
+ALTER TABLE aux_words_amount ADD CONSTRAINT aux_words_amount_user_language_word_key UNIQUE (id_user, language, word);
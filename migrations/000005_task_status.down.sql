@@ -0,0 +1,4 @@
+ALTER TABLE medias DROP COLUMN IF EXISTS task_error;
+ALTER TABLE medias DROP COLUMN IF EXISTS status;
+
+ALTER TABLE users DROP COLUMN IF EXISTS is_admin;
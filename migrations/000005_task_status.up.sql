@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN is_admin bool DEFAULT false NOT NULL;
+
+ALTER TABLE medias ADD COLUMN status varchar(16) DEFAULT 'done' NOT NULL;
+ALTER TABLE medias ADD COLUMN task_error text NULL;
@@ -0,0 +1,14 @@
+DROP INDEX IF EXISTS idx_anki_user_activity;
+ALTER TABLE anki DROP COLUMN IF EXISTS activity_at;
+
+DROP INDEX IF EXISTS idx_medias_user_activity;
+ALTER TABLE medias DROP COLUMN IF EXISTS activity_at;
+
+DROP INDEX IF EXISTS idx_output_user_activity;
+ALTER TABLE "output" DROP COLUMN IF EXISTS activity_at;
+
+DROP INDEX IF EXISTS idx_books_history_user_activity;
+ALTER TABLE books_history DROP COLUMN IF EXISTS activity_at;
+
+DROP INDEX IF EXISTS idx_vocabulary_user_activity;
+ALTER TABLE vocabulary DROP COLUMN IF EXISTS activity_at;
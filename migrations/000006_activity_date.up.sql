@@ -0,0 +1,29 @@
+ALTER TABLE anki ADD COLUMN activity_at timestamptz NULL;
+UPDATE anki SET activity_at = COALESCE(created_at, CURRENT_TIMESTAMP);
+ALTER TABLE anki ALTER COLUMN activity_at SET DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE anki ALTER COLUMN activity_at SET NOT NULL;
+CREATE INDEX idx_anki_user_activity ON anki(id_user, activity_at);
+
+ALTER TABLE medias ADD COLUMN activity_at timestamptz NULL;
+UPDATE medias SET activity_at = COALESCE(created_at, CURRENT_TIMESTAMP);
+ALTER TABLE medias ALTER COLUMN activity_at SET DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE medias ALTER COLUMN activity_at SET NOT NULL;
+CREATE INDEX idx_medias_user_activity ON medias(id_user, activity_at);
+
+ALTER TABLE "output" ADD COLUMN activity_at timestamptz NULL;
+UPDATE "output" SET activity_at = COALESCE(created_at, CURRENT_TIMESTAMP);
+ALTER TABLE "output" ALTER COLUMN activity_at SET DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE "output" ALTER COLUMN activity_at SET NOT NULL;
+CREATE INDEX idx_output_user_activity ON "output"(id_user, activity_at);
+
+ALTER TABLE books_history ADD COLUMN activity_at timestamptz NULL;
+UPDATE books_history SET activity_at = COALESCE(created_at, CURRENT_TIMESTAMP);
+ALTER TABLE books_history ALTER COLUMN activity_at SET DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE books_history ALTER COLUMN activity_at SET NOT NULL;
+CREATE INDEX idx_books_history_user_activity ON books_history(id_user, activity_at);
+
+ALTER TABLE vocabulary ADD COLUMN activity_at timestamptz NULL;
+UPDATE vocabulary SET activity_at = COALESCE(created_at, CURRENT_TIMESTAMP);
+ALTER TABLE vocabulary ALTER COLUMN activity_at SET DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE vocabulary ALTER COLUMN activity_at SET NOT NULL;
+CREATE INDEX idx_vocabulary_user_activity ON vocabulary(id_user, activity_at);
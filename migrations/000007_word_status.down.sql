@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_aux_words_amount_status;
+
+ALTER TABLE aux_words_amount DROP CONSTRAINT IF EXISTS aux_words_amount_status_check;
+
+ALTER TABLE aux_words_amount DROP COLUMN IF EXISTS status_updated_at;
+ALTER TABLE aux_words_amount DROP COLUMN IF EXISTS status;
@@ -0,0 +1,6 @@
+ALTER TABLE aux_words_amount ADD COLUMN status varchar(16) DEFAULT 'new' NOT NULL;
+ALTER TABLE aux_words_amount ADD COLUMN status_updated_at timestamptz NULL;
+
+ALTER TABLE aux_words_amount ADD CONSTRAINT aux_words_amount_status_check CHECK (status IN ('new', 'learning', 'known', 'ignored'));
+
+CREATE INDEX idx_aux_words_amount_status ON aux_words_amount(id_user, language, status);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS frequency_words;
+
+DROP INDEX IF EXISTS unique_frequency_list_shared;
+DROP INDEX IF EXISTS unique_frequency_list_user;
+
+DROP TABLE IF EXISTS frequency_lists;
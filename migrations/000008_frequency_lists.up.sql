@@ -0,0 +1,19 @@
+CREATE TABLE frequency_lists (
+	id SERIAL PRIMARY KEY,
+	id_user uuid NULL REFERENCES users(id) ON DELETE CASCADE,
+	language varchar(8) NOT NULL,
+	name varchar(128) NOT NULL,
+	created_at timestamptz DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+-- a user keeps one list per language, lists without an user are shared with everyone
+CREATE UNIQUE INDEX unique_frequency_list_user ON frequency_lists(id_user, language) WHERE id_user IS NOT NULL;
+CREATE UNIQUE INDEX unique_frequency_list_shared ON frequency_lists(language) WHERE id_user IS NULL;
+
+CREATE TABLE frequency_words (
+	id_list INT NOT NULL REFERENCES frequency_lists(id) ON DELETE CASCADE,
+	rank INT NOT NULL,
+	word INT NOT NULL REFERENCES words(id),
+	PRIMARY KEY (id_list, rank),
+	UNIQUE (id_list, word)
+);
@@ -0,0 +1,11 @@
+CREATE TABLE word_examples (
+	id BIGSERIAL PRIMARY KEY,
+	id_user uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	id_media uuid NOT NULL REFERENCES medias(id) ON DELETE CASCADE,
+	word INT NOT NULL REFERENCES words(id),
+	sentence TEXT NOT NULL,
+	start_seconds REAL NOT NULL DEFAULT 0,
+	created_at timestamptz DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_word_examples_user_word ON word_examples(id_user, word);
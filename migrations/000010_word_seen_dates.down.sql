@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_aux_words_amount_first_seen;
+
+ALTER TABLE aux_words_amount DROP COLUMN IF EXISTS last_seen_at;
+ALTER TABLE aux_words_amount DROP COLUMN IF EXISTS first_seen_at;
@@ -0,0 +1,17 @@
+ALTER TABLE aux_words_amount ADD COLUMN first_seen_at timestamptz NULL;
+ALTER TABLE aux_words_amount ADD COLUMN last_seen_at timestamptz NULL;
+
+UPDATE aux_words_amount awa
+SET first_seen_at = seen.first_seen_at, last_seen_at = seen.last_seen_at
+FROM (
+	SELECT mw.id_user, mw.word, m.target_language AS language, MIN(m.activity_at) AS first_seen_at, MAX(m.activity_at) AS last_seen_at
+	FROM media_words mw
+	INNER JOIN medias m ON m.id = mw.id_media
+	GROUP BY mw.id_user, mw.word, m.target_language
+) AS seen
+WHERE awa.id_user = seen.id_user AND awa.word = seen.word AND awa.language = seen.language;
+
+-- words counted before media_words existed have no date they were seen, they
+-- stay NULL and the growth reports them as the vocabulary before tracking
+
+CREATE INDEX idx_aux_words_amount_first_seen ON aux_words_amount(id_user, language, first_seen_at);
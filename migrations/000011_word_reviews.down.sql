@@ -0,0 +1,3 @@
+ALTER TABLE anki DROP COLUMN IF EXISTS source;
+
+DROP TABLE IF EXISTS word_reviews;
@@ -0,0 +1,15 @@
+CREATE TABLE word_reviews (
+	id_word_amount INT PRIMARY KEY REFERENCES aux_words_amount(id) ON DELETE CASCADE,
+	id_user uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	ease REAL DEFAULT 2.5 NOT NULL,
+	interval_days INT DEFAULT 0 NOT NULL,
+	repetitions INT DEFAULT 0 NOT NULL,
+	lapses INT DEFAULT 0 NOT NULL,
+	due_at timestamptz NOT NULL,
+	last_reviewed_at timestamptz NOT NULL,
+	created_at timestamptz DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_word_reviews_due ON word_reviews(id_user, due_at);
+
+ALTER TABLE anki ADD COLUMN source varchar(16) DEFAULT 'anki' NOT NULL;
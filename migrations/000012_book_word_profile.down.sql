@@ -0,0 +1,2 @@
+ALTER TABLE books DROP COLUMN IF EXISTS word_count;
+ALTER TABLE books DROP COLUMN IF EXISTS words_per_page;
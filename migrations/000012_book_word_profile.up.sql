@@ -0,0 +1,5 @@
+ALTER TABLE books ADD COLUMN words_per_page INT NULL;
+ALTER TABLE books ADD COLUMN word_count INT NULL;
+
+-- the first entry of a book used to store the reading speed times the words per page
+UPDATE books_history SET total_words = 0 WHERE actual_page = 0;
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS book_chapters;
+
+ALTER TABLE books DROP COLUMN IF EXISTS author;
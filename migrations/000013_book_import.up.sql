@@ -0,0 +1,11 @@
+ALTER TABLE books ADD COLUMN author varchar(256) NULL;
+
+CREATE TABLE book_chapters (
+	id SERIAL PRIMARY KEY,
+	id_book uuid NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+	position INT NOT NULL,
+	title TEXT NOT NULL,
+	content TEXT NOT NULL,
+	words INT NOT NULL,
+	UNIQUE(id_book, position)
+);
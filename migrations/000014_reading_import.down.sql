@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_books_history_import_key;
+
+ALTER TABLE books_history DROP COLUMN IF EXISTS import_key;
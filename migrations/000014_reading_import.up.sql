@@ -0,0 +1,3 @@
+ALTER TABLE books_history ADD COLUMN import_key varchar(64) NULL;
+
+CREATE UNIQUE INDEX idx_books_history_import_key ON books_history(id_book, import_key) WHERE import_key IS NOT NULL;
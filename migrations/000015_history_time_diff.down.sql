@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_books_history_book_activity;
+
+ALTER TABLE books_history ALTER COLUMN time_diff DROP NOT NULL;
+ALTER TABLE books_history ALTER COLUMN time_diff DROP DEFAULT;
+
+ALTER TABLE books_history ALTER COLUMN "time" TYPE time USING "time"::time;
@@ -0,0 +1,24 @@
+-- the running total is an interval, a time of day wraps past 24 hours
+ALTER TABLE books_history ALTER COLUMN "time" TYPE interval USING "time"::interval;
+
+-- the reading time of an entry is the source of the running totals, entries
+-- recorded before it was kept get the difference with the previous entry
+UPDATE books_history bh SET time_diff = s.diff
+FROM (
+	SELECT id, GREATEST(time - COALESCE(LAG(time) OVER (PARTITION BY id_book ORDER BY activity_at, id), interval '0'), interval '0')::time AS diff
+	FROM books_history
+) s
+WHERE bh.id = s.id AND bh.time_diff IS NULL;
+
+ALTER TABLE books_history ALTER COLUMN time_diff SET DEFAULT '00:00:00';
+ALTER TABLE books_history ALTER COLUMN time_diff SET NOT NULL;
+
+-- the running totals stored before were wrapped, they are summed again
+UPDATE books_history bh SET "time" = s.total
+FROM (
+	SELECT id, SUM(time_diff::interval) OVER (PARTITION BY id_book ORDER BY activity_at, id) AS total
+	FROM books_history
+) s
+WHERE bh.id = s.id AND bh."time" IS DISTINCT FROM s.total;
+
+CREATE INDEX idx_books_history_book_activity ON books_history(id_book, activity_at, id);
@@ -0,0 +1 @@
+ALTER TABLE books ADD COLUMN isbn varchar(13) NULL;
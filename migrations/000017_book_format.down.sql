@@ -0,0 +1,3 @@
+ALTER TABLE books DROP COLUMN IF EXISTS level;
+ALTER TABLE books DROP CONSTRAINT IF EXISTS books_format_check;
+ALTER TABLE books DROP COLUMN IF EXISTS format;
@@ -0,0 +1,7 @@
+-- audiobooks keep the position and the duration in minutes in the page columns
+-- of their history
+ALTER TABLE books ADD COLUMN format varchar(16) NOT NULL DEFAULT 'paper';
+ALTER TABLE books ADD CONSTRAINT books_format_check CHECK (format IN ('paper', 'ebook', 'audiobook', 'manga', 'graded'));
+ALTER TABLE books ADD COLUMN level varchar(32) NULL;
+
+UPDATE books SET format = 'ebook' WHERE EXISTS (SELECT 1 FROM book_chapters WHERE id_book = books.id);
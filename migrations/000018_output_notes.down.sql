@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_output_search;
+
+ALTER TABLE output DROP COLUMN IF EXISTS search;
+ALTER TABLE output DROP COLUMN IF EXISTS topic;
+ALTER TABLE output DROP COLUMN IF EXISTS partner;
@@ -0,0 +1,12 @@
+ALTER TABLE output ADD COLUMN partner varchar(128) NULL;
+ALTER TABLE output ADD COLUMN topic varchar(256) NULL;
+
+-- the sessions are in many languages, the simple configuration does not stem
+ALTER TABLE output ADD COLUMN search tsvector GENERATED ALWAYS AS (
+	setweight(to_tsvector('simple', COALESCE(topic, '')), 'A') ||
+	setweight(to_tsvector('simple', COALESCE(partner, '')), 'B') ||
+	setweight(to_tsvector('simple', COALESCE(summarize, '')), 'C') ||
+	setweight(to_tsvector('simple', type), 'D')
+) STORED;
+
+CREATE INDEX idx_output_search ON output USING GIN(search);
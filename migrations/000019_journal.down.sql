@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS produced_words;
+DROP TABLE IF EXISTS journal_words;
+DROP TABLE IF EXISTS journal;
@@ -0,0 +1,36 @@
+CREATE TABLE journal (
+	id uuid DEFAULT gen_random_uuid() PRIMARY KEY,
+	id_user uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	title varchar(256) NULL,
+	content TEXT NOT NULL,
+	target_language varchar(5) NOT NULL,
+	total_words INT NOT NULL DEFAULT 0,
+	distinct_words INT NOT NULL DEFAULT 0,
+	time time NOT NULL DEFAULT '00:00:00',
+	activity_at timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	created_at timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_journal_user_activity ON journal(id_user, activity_at);
+
+CREATE TABLE journal_words (
+	id_journal uuid NOT NULL REFERENCES journal(id) ON DELETE CASCADE,
+	word INT NOT NULL REFERENCES words(id),
+	amount INT NOT NULL,
+	PRIMARY KEY (id_journal, word)
+);
+
+CREATE INDEX idx_journal_words_word ON journal_words(word);
+
+-- the words the user wrote, the active vocabulary, apart from the words met in
+-- medias and books in aux_words_amount
+CREATE TABLE produced_words (
+	id SERIAL PRIMARY KEY,
+	id_user uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	word INT NOT NULL REFERENCES words(id),
+	language varchar(5) NOT NULL,
+	amount INT NOT NULL,
+	first_used_at timestamptz NOT NULL,
+	last_used_at timestamptz NOT NULL,
+	UNIQUE(id_user, language, word)
+);
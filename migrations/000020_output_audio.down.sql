@@ -0,0 +1,4 @@
+ALTER TABLE output DROP COLUMN IF EXISTS audio_seconds;
+ALTER TABLE output DROP COLUMN IF EXISTS audio_size;
+ALTER TABLE output DROP COLUMN IF EXISTS audio_content_type;
+ALTER TABLE output DROP COLUMN IF EXISTS audio_key;
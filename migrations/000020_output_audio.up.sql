@@ -0,0 +1,4 @@
+ALTER TABLE output ADD COLUMN audio_key varchar(512) NULL;
+ALTER TABLE output ADD COLUMN audio_content_type varchar(64) NULL;
+ALTER TABLE output ADD COLUMN audio_size bigint NULL;
+ALTER TABLE output ADD COLUMN audio_seconds real NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE books DROP COLUMN IF EXISTS words_to_page;
+
+DROP TABLE IF EXISTS book_words;
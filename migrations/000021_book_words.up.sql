@@ -0,0 +1,22 @@
+-- the words each page range of an imported book added to the user words, so
+-- they can be taken back when the book or its history changes. The rows
+-- outlive a deleted book until the delete task takes the words back.
+CREATE TABLE book_words (
+	id_book uuid NOT NULL,
+	id_user uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	language varchar(8) NOT NULL,
+	from_page INT NOT NULL,
+	to_page INT NOT NULL,
+	word INT NOT NULL REFERENCES words(id),
+	amount INT NOT NULL,
+	PRIMARY KEY (id_book, from_page, word)
+);
+
+CREATE INDEX idx_book_words_user ON book_words(id_user);
+
+-- the pages of an imported book whose words were already counted
+ALTER TABLE books ADD COLUMN words_to_page INT DEFAULT 0 NOT NULL;
+
+-- the words counted before were not recorded, they are not counted again
+UPDATE books b SET words_to_page = COALESCE((SELECT MAX(actual_page) FROM books_history WHERE id_book = b.id), 0)
+WHERE EXISTS (SELECT 1 FROM book_chapters WHERE id_book = b.id);
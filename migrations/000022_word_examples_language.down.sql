@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_word_examples_user_language_word;
+CREATE INDEX idx_word_examples_user_word ON word_examples(id_user, word);
+
+ALTER TABLE word_examples DROP COLUMN IF EXISTS language;
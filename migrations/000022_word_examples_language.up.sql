@@ -0,0 +1,9 @@
+-- the cap of examples per word is kept for each language of the user
+ALTER TABLE word_examples ADD COLUMN language varchar(8);
+
+UPDATE word_examples e SET language = m.target_language FROM medias m WHERE m.id = e.id_media;
+
+ALTER TABLE word_examples ALTER COLUMN language SET NOT NULL;
+
+DROP INDEX IF EXISTS idx_word_examples_user_word;
+CREATE INDEX idx_word_examples_user_language_word ON word_examples(id_user, language, word);